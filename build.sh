@@ -10,9 +10,15 @@ go mod tidy
 go build -o bin/onefile main.go
 
 # Build individual commands
+go build -o bin/crate2file cmd/crate2file/main.go
 go build -o bin/dump cmd/dump/main.go
+go build -o bin/git2file cmd/git2file/main.go
 go build -o bin/github2file cmd/github2file/main.go
+go build -o bin/gitlab2file cmd/gitlab2file/main.go
+go build -o bin/gomod2file cmd/gomod2file/main.go
 go build -o bin/json2md cmd/json2md/main.go
+go build -o bin/md2json cmd/md2json/main.go
+go build -o bin/npm2file cmd/npm2file/main.go
 go build -o bin/pypi2file cmd/pypi2file/main.go
 go build -o bin/reconstruct cmd/reconstruct/main.go
 
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gusanmaz/onefile/utils"
@@ -148,4 +149,46 @@ func TestReconstructCommand(t *testing.T) {
 	os.Remove("test_dump.json")
 }
 
+func TestJSON2MDCommand(t *testing.T) {
+	setupTestProject(t)
+	defer teardownTestProject(t)
+
+	logo := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01")
+	if err := ioutil.WriteFile(filepath.Join(testProjectPath, "logo.png"), logo, 0644); err != nil {
+		t.Fatalf("Failed to create logo.png: %v", err)
+	}
+
+	dumpCmd := NewDumpCmd()
+	dumpCmd.SetArgs([]string{"-p", testProjectPath, "-o", "test_binary", "-t", "json", "--include-non-text"})
+	if err := dumpCmd.Execute(); err != nil {
+		t.Fatalf("Dump command failed: %v", err)
+	}
+	defer os.Remove("test_binary.json")
+	defer os.Remove("test_binary.md")
+
+	for _, includeNonText := range []bool{false, true} {
+		args := []string{"-j", "test_binary.json", "-o", "test_binary.md"}
+		if includeNonText {
+			args = append(args, "--include-non-text")
+		}
+		json2mdCmd := NewJSON2MDCmd()
+		json2mdCmd.SetArgs(args)
+		if err := json2mdCmd.Execute(); err != nil {
+			t.Fatalf("json2md command failed: %v", err)
+		}
+
+		data, err := ioutil.ReadFile("test_binary.md")
+		if err != nil {
+			t.Fatalf("Failed to read Markdown output: %v", err)
+		}
+		markdown := string(data)
+		if !strings.Contains(markdown, "main.go") {
+			t.Errorf("json2md (include non-text %v) left out main.go", includeNonText)
+		}
+		if strings.Contains(markdown, "logo.png") != includeNonText || strings.Contains(markdown, "base64") != includeNonText {
+			t.Errorf("json2md (include non-text %v) output of logo.png:\n%s", includeNonText, markdown)
+		}
+	}
+}
+
 // Add more tests for other commands as needed
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gusanmaz/onefile/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewCrate2FileCmd() *cobra.Command {
+	var crateName, version, indexURL, outputType, outputDir, outputName string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens int
+	var includeGit, includeNonText, showExcluded bool
+	var cmd = &cobra.Command{
+		Use:   "crate2file",
+		Short: "Fetch a Rust crate and save as JSON or Markdown",
+		Long: `Fetch a Rust crate and save its structure and contents as JSON or Markdown.
+
+The crate is given by name, optionally with a version:
+- serde (the latest release that is not yanked)
+- serde@1.0.190 or --version 1.0.190
+
+Crates are resolved in the sparse registry index given by --index, e.g. an
+alternative registry or a mirror. The downloaded .crate archive is checked
+against the checksum in the index and dumped without its leading
+name-version/ directory.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
+			}
+
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
+				return
+			}
+
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
+
+			name, specVersion := utils.ParseCrateSpec(crateName)
+			if version == "" {
+				version = specVersion
+			}
+
+			projectData, err := utils.FetchCrate(indexURL, name, version, gitIgnore, includeGit, includeNonText)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching crate: %v\n", err)
+				return
+			}
+
+			if outputName == "" {
+				outputName = name + "_" + projectData.Ref
+			}
+
+			// Create output directory if it doesn't exist
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+				return
+			}
+
+			tokenizer, err := utils.GetTokenizer("approx")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
+				return
+			}
+
+			outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
+				return
+			}
+
+			for _, outputPath := range outputPaths {
+				fmt.Printf("Output file created successfully: %s\n", outputPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&crateName, "crate", "c", "", "Crate name, optionally with @version")
+	cmd.Flags().StringVar(&version, "version", "", "Version to fetch (default: latest)")
+	cmd.Flags().StringVar(&indexURL, "index", utils.DefaultCrateIndex, "URL of the sparse registry index")
+	cmd.Flags().StringVarP(&outputType, "type", "t", "md", "Output type: json or md")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
+	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
+	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
+	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
+	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
+	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
+
+	cmd.MarkFlagRequired("crate")
+
+	return cmd
+}
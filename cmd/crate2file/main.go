@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gusanmaz/onefile/cmd"
+)
+
+func main() {
+	if err := cmd.NewCrate2FileCmd().Execute(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -3,63 +3,187 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 
 	"github.com/gusanmaz/onefile/utils"
+	ignore "github.com/sabhiram/go-gitignore"
 	"github.com/spf13/cobra"
 )
 
 func NewDumpCmd() *cobra.Command {
-	var rootPath, outputPath, outputType string
-	var excludePatterns []string
-	var includeGit, includeNonText, showExcluded bool
+	var rootPath, outputPath, outputType, tokenizerName, since string
+	var excludePatterns, includePatterns, priorityRules []string
+	var maxTokens, chunkBytes, chunkTokens, jobs int
+	var includeGit, includeNonText, showExcluded, truncate, useGitignore, gitTracked, untracked, staged, worktree, withDiff bool
 	var cmd = &cobra.Command{
 		Use:   "dump",
 		Short: "Dump a local project to JSON or Markdown",
 		Long: `Dump a local project to JSON or Markdown.
 Exclude patterns can be specified directly or by referencing a file with @.
-Example: -e "*.go @.gitignore" -e "utils/extension_language_map.json go.mod go.sum"`,
-		Run: func(cmd *cobra.Command, args []string) {
-			// Process exclude patterns
-			var processedPatterns []string
-			for _, pattern := range excludePatterns {
-				patterns := strings.Fields(pattern)
-				processedPatterns = append(processedPatterns, patterns...)
-			}
+Example: -e "*.go @.gitignore" -e "utils/extension_language_map.json go.mod go.sum"
+
+By default the .gitignore files of every directory, .git/info/exclude, the
+global core.excludesFile and .onefileignore files are applied as git would
+apply them; -e patterns take precedence over all of them.
+
+With -i, only files matching one of the include patterns are dumped. Excludes
+take precedence over includes. Example: -i "cmd/**/*.go utils/**/*.go go.mod"
+
+With --git-tracked, only the files in the git index are dumped, including
+staged but uncommitted ones, instead of everything under the path; ignore
+files are not consulted for them. --untracked adds files that are neither
+tracked nor ignored.
 
-			parsedExcludePatterns, err := utils.ParsePatterns(processedPatterns)
+With --since <ref>, only the files added or modified since the merge base of
+ref and HEAD are dumped, including uncommitted changes. --staged selects the
+changes in the index and --worktree the unstaged changes in the working tree
+(both together: all changes since HEAD). --diff adds the unified diff of each
+file after its contents. These options run git.
+
+With --max-tokens, the lowest-priority files are dropped from the output (or
+truncated with --truncate) until it fits the token budget. Priorities come
+from built-in rules that favour READMEs and manifests over tests and lock files,
+extended with --priority "pattern=priority" rules.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
 				return
 			}
 
-			gitIgnore := utils.CreateGitIgnoreMatcher(parsedExcludePatterns)
-
-			projectData, err := utils.DumpProject(rootPath, gitIgnore, includeGit, includeNonText)
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error dumping project: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
 				return
 			}
 
+			changesOnly := since != "" || staged || worktree
+			if withDiff && !changesOnly {
+				fmt.Fprintln(os.Stderr, "Error: --diff requires --since, --staged or --worktree")
+				return
+			}
+
+			var gitIgnore ignore.IgnoreParser = utils.CreateGitIgnoreMatcher(parsedExcludePatterns)
+			if useGitignore && !gitTracked && !changesOnly {
+				gitIgnore, err = utils.NewRepoIgnore(rootPath, parsedExcludePatterns)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading ignore files: %v\n", err)
+					return
+				}
+			}
+			gitIgnore = utils.CreatePathMatcher(gitIgnore, parsedIncludePatterns)
+
 			if outputPath == "" {
 				outputPath = "project_data"
 			}
 
-			if outputType == "json" {
-				err = utils.SaveAsJSON(projectData, outputPath+".json", includeGit, includeNonText)
-			} else if outputType == "md" {
-				err = utils.SaveAsMarkdown(projectData, outputPath+".md", includeGit, includeNonText, showExcluded)
+			var paths []string
+			if changesOnly {
+				paths, err = utils.GitChangedFiles(rootPath, since, staged, worktree)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error listing changed files: %v\n", err)
+					return
+				}
+			} else if gitTracked {
+				paths, err = utils.GitTrackedFiles(rootPath, untracked)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error listing git tracked files: %v\n", err)
+					return
+				}
+			}
+
+			var diffs map[string]string
+			if withDiff {
+				diffs, err = utils.GitDiffs(rootPath, paths, since, staged, worktree)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error generating diffs: %v\n", err)
+					return
+				}
+			}
+			listed := gitTracked || changesOnly
+
+			if maxTokens <= 0 && chunkBytes <= 0 && chunkTokens <= 0 {
+				// Nothing needs the whole project at once, so stream it to the output
+				err = streamOutput(outputPath, outputType, includeGit, includeNonText, showExcluded, func(w utils.ProjectWriter) error {
+					if diffs != nil {
+						w = &diffWriter{ProjectWriter: w, diffs: diffs}
+					}
+					if listed {
+						return utils.StreamProjectFiles(rootPath, paths, gitIgnore, includeGit, includeNonText, jobs, w)
+					}
+					return utils.StreamProject(rootPath, gitIgnore, includeGit, includeNonText, jobs, w)
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error dumping project: %v\n", err)
+					return
+				}
+
+				fmt.Printf("Project dumped to %s.%s\n", outputPath, outputType)
+				return
+			}
+
+			tokenizer, err := utils.GetTokenizer(tokenizerName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
+				return
+			}
+
+			var projectData utils.ProjectData
+			if listed {
+				projectData, err = utils.DumpProjectFiles(rootPath, paths, gitIgnore, includeGit, includeNonText, jobs)
 			} else {
-				fmt.Fprintf(os.Stderr, "Invalid output type. Use 'json' or 'md'\n")
+				projectData, err = utils.DumpProject(rootPath, gitIgnore, includeGit, includeNonText, jobs)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error dumping project: %v\n", err)
 				return
 			}
+			for i := range projectData.Files {
+				projectData.Files[i].Diff = diffs[projectData.Files[i].Path]
+			}
+
+			if maxTokens > 0 {
+				rules, err := utils.ParsePriorityRules(append(utils.DefaultPriorityRules, priorityRules...))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error parsing priority rules: %v\n", err)
+					return
+				}
+
+				render := func(data utils.ProjectData) (string, error) {
+					if outputType == "json" {
+						output, err := utils.GenerateJSON(data, includeGit, includeNonText)
+						return string(output), err
+					}
+					return utils.GenerateMarkdown(data, includeGit, includeNonText, showExcluded), nil
+				}
+
+				var report utils.BudgetReport
+				projectData, report, err = utils.FitToTokenBudget(projectData, maxTokens, tokenizer, rules, truncate, render)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error fitting token budget: %v\n", err)
+					return
+				}
+
+				fmt.Printf("Token budget: %d of %d tokens used\n", report.UsedTokens, report.MaxTokens)
+				if len(report.Truncated) > 0 {
+					fmt.Printf("Truncated %d file(s): %s\n", len(report.Truncated), strings.Join(report.Truncated, ", "))
+				}
+				if len(report.Dropped) > 0 {
+					fmt.Printf("Dropped %d file(s): %s\n", len(report.Dropped), strings.Join(report.Dropped, ", "))
+				}
+			}
 
+			outputPaths, err := saveOutput(projectData, outputPath, outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
 				return
 			}
 
-			fmt.Printf("Project dumped to %s.%s\n", outputPath, outputType)
+			fmt.Printf("Project dumped to %s\n", strings.Join(outputPaths, ", "))
 		},
 	}
 
@@ -67,9 +191,36 @@ Example: -e "*.go @.gitignore" -e "utils/extension_language_map.json go.mod go.s
 	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file name (without extension)")
 	cmd.Flags().StringVarP(&outputType, "type", "t", "json", "Output type: json or md")
 	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
 	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
 	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
+	cmd.Flags().BoolVar(&useGitignore, "use-gitignore", true, "Apply .gitignore, .git/info/exclude, global git excludes and .onefileignore files")
+	cmd.Flags().BoolVar(&gitTracked, "git-tracked", false, "Dump only the files tracked in the git index")
+	cmd.Flags().BoolVar(&untracked, "untracked", false, "With --git-tracked, also dump untracked files that are not ignored")
+	cmd.Flags().StringVar(&since, "since", "", "Dump only the files changed since the merge base of this git ref and HEAD")
+	cmd.Flags().BoolVar(&staged, "staged", false, "Dump only the files with staged changes")
+	cmd.Flags().BoolVar(&worktree, "worktree", false, "Dump only the files with unstaged changes in the working tree")
+	cmd.Flags().BoolVar(&withDiff, "diff", false, "Include the unified diff of each changed file")
 	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Number of files to read in parallel")
+	cmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Maximum number of tokens in the output (0 for no limit)")
+	cmd.Flags().StringVar(&tokenizerName, "tokenizer", "approx", "Tokenizer used to count tokens: approx or chars")
+	cmd.Flags().StringArrayVar(&priorityRules, "priority", []string{}, "Priority rules as pattern=priority; higher priorities are kept first (e.g., \"docs/=-20\")")
+	cmd.Flags().BoolVar(&truncate, "truncate", false, "Truncate files that exceed the remaining token budget instead of dropping them")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
 
 	return cmd
 }
+
+// diffWriter attaches the diffs of changed files to the files written to the
+// wrapped ProjectWriter.
+type diffWriter struct {
+	utils.ProjectWriter
+	diffs map[string]string
+}
+
+func (w *diffWriter) WriteFile(file utils.FileData) error {
+	file.Diff = w.diffs[file.Path]
+	return w.ProjectWriter.WriteFile(file)
+}
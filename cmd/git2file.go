@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gusanmaz/onefile/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewGit2FileCmd() *cobra.Command {
+	var repoURL, outputType, outputDir, outputName, ref, path string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens int
+	var includeGit, includeNonText, showExcluded bool
+	var cmd = &cobra.Command{
+		Use:   "git2file",
+		Short: "Fetch any git repository and save as JSON or Markdown",
+		Long: `Fetch a git repository from any host and save its structure and contents as
+JSON or Markdown. Exclude and include patterns work as in github2file.
+
+The URL is anything git clones from:
+- HTTPS: https://codeberg.org/owner/repo.git
+- SSH: git@bitbucket.org:owner/repo.git or ssh://git@host/owner/repo.git
+- Local: file:///srv/git/repo.git or /srv/git/repo.git
+
+The repository is fetched with a shallow clone, which needs git to be
+installed. With --path, only that directory is checked out, and its files are
+the only ones downloaded from servers that support partial clones.
+
+Authentication is left to git: SSH keys, credential helpers and URLs with
+credentials all work as they do for git clone.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
+			}
+
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
+				return
+			}
+
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
+
+			projectData, err := utils.FetchGitRepo(repoURL, ref, path, gitIgnore, includeGit, includeNonText)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching git repository: %v\n", err)
+				return
+			}
+
+			if outputName == "" {
+				outputName = gitRepoName(repoURL)
+				if ref != "" {
+					outputName += "_" + strings.ReplaceAll(ref, "/", "_")
+				}
+				if path = strings.Trim(path, "/"); path != "" {
+					outputName += "_" + strings.ReplaceAll(path, "/", "_")
+				}
+			}
+
+			tokenizer, err := utils.GetTokenizer("approx")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
+				return
+			}
+
+			outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
+				return
+			}
+
+			for _, outputPath := range outputPaths {
+				fmt.Printf("Output file created successfully: %s\n", outputPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&repoURL, "url", "u", "", "Clone URL of the repository (https, ssh, scp-like or file)")
+	cmd.Flags().StringVarP(&outputType, "type", "t", "md", "Output type: json or md")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
+	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
+	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
+	cmd.Flags().StringVarP(&ref, "ref", "r", "", "Branch, tag or commit SHA to fetch (default: the default branch)")
+	cmd.Flags().StringVarP(&path, "path", "p", "", "Directory of the repository to fetch (default: all of it)")
+	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
+	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
+	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
+
+	cmd.MarkFlagRequired("url")
+
+	return cmd
+}
+
+// gitRepoName returns the name of the repository at a clone URL: the last
+// segment of its path without the .git suffix.
+func gitRepoName(repoURL string) string {
+	name := strings.TrimRight(repoURL, "/")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSuffix(name, ".git")
+	if name == "" {
+		return "repo"
+	}
+	return name
+}
@@ -12,9 +12,11 @@ import (
 )
 
 func NewGitHub2FileCmd() *cobra.Command {
-	var repoURL, outputType, outputDir, outputName, githubToken string
-	var excludePatterns []string
-	var allRepos, useGit, includeGit, includeNonText, showExcluded bool
+	var repoURL, outputType, outputDir, outputName, githubToken, ref, method, githubHost, apiURL string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens, concurrency int
+	var allRepos, useGit, includeGit, includeNonText, showExcluded, verbose bool
+	var filter utils.RepoFilter
 	var cmd = &cobra.Command{
 		Use:   "github2file",
 		Short: "Fetch a GitHub repository and save as JSON or Markdown",
@@ -25,46 +27,98 @@ Example: -e "*.go @.gitignore" -e "utils/extension_language_map.json go.mod go.s
 The repository URL can be specified in various formats:
 - Full URL: https://github.com/username/repo
 - Without protocol: github.com/username/repo
-- Short form: username/repo`,
+- Short form: username/repo
+- A ref and directory: https://github.com/username/repo/tree/feature/x/docs
+
+Refs may contain slashes; they are told apart from the directory by looking up
+the repository's branches and tags. --ref takes precedence over a ref in the
+URL. The commit SHA that was fetched is recorded in the output.
+
+With --all-repos, every repository of the user or organization in the URL is
+fetched, e.g. -a -u my-org --include-forks=false --include-archived=false.
+Private repositories need a token with access to them.
+
+The repository is fetched with a shallow git clone if git is installed, and
+otherwise as a single tarball download. --method api walks the contents API
+instead, which takes one request per directory and file; --concurrency sets
+how many of those requests run at a time.
+
+GitHub API requests are retried with backoff on network and server errors.
+When the rate limit is hit, the command waits for it to reset if that is a
+few minutes away and stops with an explanation otherwise. --verbose reports
+the remaining quota after every request.
+
+Without --token, a token is taken from GITHUB_TOKEN or GH_TOKEN, the hosts
+file of the gh CLI or git's credential helpers, in that order. It is used for
+API requests and for git clones, so private repositories can be fetched with
+every method.
+
+For GitHub Enterprise Server, either use full URLs of the server or set
+--github-host so that owner/repo shorthands refer to it. The API is expected
+at https://<host>/api/v3 unless --api-url says otherwise, and tokens are read
+from GH_ENTERPRISE_TOKEN or GITHUB_ENTERPRISE_TOKEN instead of GITHUB_TOKEN.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			if repoURL == "" && !allRepos {
 				fmt.Println("Please provide a GitHub repository URL or use the -a flag")
 				return
 			}
 
-			// Process exclude patterns
-			var processedPatterns []string
-			for _, pattern := range excludePatterns {
-				patterns := strings.Fields(pattern)
-				processedPatterns = append(processedPatterns, patterns...)
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
 			}
 
-			parsedExcludePatterns, err := utils.ParsePatterns(processedPatterns)
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
 				return
 			}
 
-			gitIgnore := utils.CreateGitIgnoreMatcher(parsedExcludePatterns)
+			if filter.Visibility != "all" && filter.Visibility != "public" && filter.Visibility != "private" {
+				fmt.Fprintf(os.Stderr, "Error: invalid visibility %q, use all, public or private\n", filter.Visibility)
+				return
+			}
 
-			if allRepos {
-				owner, _, _, err := utils.ParseGitHubURL(repoURL)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error parsing GitHub URL: %v\n", err)
-					return
+			// --use-git=false has always meant the contents API
+			if method == utils.FetchMethodAuto && !useGit {
+				method = utils.FetchMethodAPI
+			}
+
+			host, owner, err := utils.ParseGitHubOwner(repoURL, githubHost)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing GitHub URL: %v\n", err)
+				return
+			}
+			if apiURL == "" {
+				apiURL = utils.GitHubAPIURL(host)
+			}
+
+			if githubToken == "" {
+				var source string
+				githubToken, source = utils.ResolveGitHubToken(host)
+				if verbose && source != "" {
+					fmt.Fprintf(os.Stderr, "Using GitHub token from %s\n", source)
 				}
+			}
+
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
 
-				repos, err := utils.FetchUserRepos(owner, githubToken)
+			if allRepos {
+				repos, err := utils.FetchUserRepos(apiURL, owner, githubToken, filter, verbose)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Error fetching user repositories: %v\n", err)
 					return
 				}
 
 				for _, repo := range repos {
-					fetchAndSaveRepo(fmt.Sprintf("%s/%s", owner, repo.Name), outputType, outputDir, outputName, gitIgnore, useGit, githubToken, includeGit, includeNonText, showExcluded)
+					fetchAndSaveRepo(fmt.Sprintf("%s/%s", owner, repo.Name), host, ref, outputType, outputDir, outputName, gitIgnore, method, apiURL, githubToken, concurrency, includeGit, includeNonText, showExcluded, verbose, chunkBytes, chunkTokens)
 				}
 			} else {
-				fetchAndSaveRepo(repoURL, outputType, outputDir, outputName, gitIgnore, useGit, githubToken, includeGit, includeNonText, showExcluded)
+				fetchAndSaveRepo(repoURL, host, ref, outputType, outputDir, outputName, gitIgnore, method, apiURL, githubToken, concurrency, includeGit, includeNonText, showExcluded, verbose, chunkBytes, chunkTokens)
 			}
 		},
 	}
@@ -74,51 +128,70 @@ The repository URL can be specified in various formats:
 	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
 	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
 	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
-	cmd.Flags().BoolVarP(&allRepos, "all-repos", "a", false, "Fetch all repositories for a user")
-	cmd.Flags().BoolVarP(&useGit, "use-git", "g", true, "Use git clone if available")
-	cmd.Flags().StringVarP(&githubToken, "token", "k", "", "GitHub API token")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
+	cmd.Flags().StringVarP(&ref, "ref", "r", "", "Branch, tag or commit SHA to fetch (default: the default branch or the ref in the URL)")
+	cmd.Flags().BoolVarP(&allRepos, "all-repos", "a", false, "Fetch all repositories of a user or organization")
+	cmd.Flags().BoolVar(&filter.IncludeForks, "include-forks", true, "With --all-repos, include forked repositories")
+	cmd.Flags().BoolVar(&filter.IncludeArchived, "include-archived", true, "With --all-repos, include archived repositories")
+	cmd.Flags().StringVar(&filter.Visibility, "visibility", "all", "With --all-repos, fetch all, public or private repositories")
+	cmd.Flags().StringVar(&filter.Language, "language", "", "With --all-repos, only fetch repositories in this primary language")
+	cmd.Flags().StringVar(&filter.Topic, "topic", "", "With --all-repos, only fetch repositories with this topic")
+	cmd.Flags().BoolVarP(&useGit, "use-git", "g", true, "Use git clone if available (false: use the contents API, like --method api)")
+	cmd.Flags().StringVarP(&method, "method", "m", utils.FetchMethodAuto, "Fetch method: auto (git if installed, else tarball), git, tarball or api")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of concurrent requests of the api method")
+	cmd.Flags().StringVar(&githubHost, "github-host", utils.DefaultGitHubHost, "Host of owner/repo shorthands, e.g. a GitHub Enterprise Server")
+	cmd.Flags().StringVar(&apiURL, "api-url", "", "Base URL of the GitHub REST API (default: https://api.github.com, or https://<host>/api/v3)")
+	cmd.Flags().StringVarP(&githubToken, "token", "k", "", "GitHub API token (default: from GITHUB_TOKEN, GH_TOKEN, gh or git credentials)")
 	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
 	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
 	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Report the remaining GitHub API quota after every request")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
 
 	return cmd
 }
 
-func fetchAndSaveRepo(repoURL, outputType, outputDir, outputName string, gitIgnore *ignore.GitIgnore, useGit bool, githubToken string, includeGit, includeNonText, showExcluded bool) {
-	owner, repo, path, err := utils.ParseGitHubURL(repoURL)
+func fetchAndSaveRepo(repoURL, githubHost, ref, outputType, outputDir, outputName string, gitIgnore ignore.IgnoreParser, method, apiURL, githubToken string, concurrency int, includeGit, includeNonText, showExcluded, verbose bool, chunkBytes, chunkTokens int) {
+	location, err := utils.ParseGitHubURL(repoURL, githubHost)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing GitHub URL: %v\n", err)
 		return
 	}
-
-	if outputName == "" {
-		outputName = fmt.Sprintf("%s_%s", owner, repo)
-		if path != "" {
-			outputName += "_" + strings.ReplaceAll(path, "/", "_")
-		}
+	if ref != "" {
+		location.SetRef(ref)
 	}
 
-	projectData, err := utils.FetchGithubRepo(owner, repo, path, gitIgnore, useGit, githubToken, includeGit, includeNonText)
+	projectData, err := utils.FetchGithubRepo(&location, gitIgnore, method, apiURL, githubToken, concurrency, includeGit, includeNonText, verbose)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error fetching GitHub repo: %v\n", err)
 		return
 	}
 
-	outputPath := filepath.Join(outputDir, outputName+"."+outputType)
+	if outputName == "" {
+		// A ref with slashes and the path are only told apart while fetching
+		outputName = fmt.Sprintf("%s_%s", location.Owner, location.Repo)
+		if location.Ref != "" {
+			outputName += "_" + strings.ReplaceAll(location.Ref, "/", "_")
+		}
+		if location.Path != "" {
+			outputName += "_" + strings.ReplaceAll(location.Path, "/", "_")
+		}
+	}
 
-	if outputType == "json" {
-		err = utils.SaveAsJSON(projectData, outputPath, includeGit, includeNonText)
-	} else if outputType == "md" {
-		err = utils.SaveAsMarkdown(projectData, outputPath, includeGit, includeNonText, showExcluded)
-	} else {
-		fmt.Fprintf(os.Stderr, "Invalid output type. Use 'json' or 'md'\n")
+	tokenizer, err := utils.GetTokenizer("approx")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
 		return
 	}
 
+	outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
 		return
 	}
 
-	fmt.Printf("Output file created successfully: %s\n", outputPath)
+	for _, outputPath := range outputPaths {
+		fmt.Printf("Output file created successfully: %s\n", outputPath)
+	}
 }
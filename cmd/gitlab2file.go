@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gusanmaz/onefile/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewGitLab2FileCmd() *cobra.Command {
+	var projectURL, outputType, outputDir, outputName, gitlabToken, ref, method, gitlabHost, apiURL string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens, concurrency int
+	var includeGit, includeNonText, showExcluded, verbose bool
+	var cmd = &cobra.Command{
+		Use:   "gitlab2file",
+		Short: "Fetch a GitLab project and save as JSON or Markdown",
+		Long: `Fetch a GitLab project and save its structure and contents as JSON or Markdown.
+Exclude and include patterns work as in github2file.
+
+The project URL can be specified in various formats:
+- Full URL: https://gitlab.com/group/subgroup/project
+- Short form: group/subgroup/project
+- A ref and directory: https://gitlab.com/group/project/-/tree/feature/x/docs
+
+Projects on self-managed instances are fetched from full URLs of the instance,
+or from short forms with --gitlab-host. The API is expected at
+https://<host>/api/v4 unless --api-url says otherwise.
+
+The project is fetched with a shallow git clone if git is installed, and
+otherwise as the repository archive. --method api lists the repository tree
+and downloads each file, --concurrency at a time.
+
+Without --token, a token is taken from GITLAB_TOKEN or git's credential
+helpers. Private projects need a token with the read_api or read_repository
+scope.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
+			}
+
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
+				return
+			}
+
+			location, err := utils.ParseGitLabURL(projectURL, gitlabHost)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing GitLab URL: %v\n", err)
+				return
+			}
+			if ref != "" {
+				location.SetRef(ref)
+			}
+
+			if gitlabToken == "" {
+				var source string
+				gitlabToken, source = utils.ResolveGitLabToken(location.Host)
+				if verbose && source != "" {
+					fmt.Fprintf(os.Stderr, "Using GitLab token from %s\n", source)
+				}
+			}
+
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
+
+			projectData, err := utils.FetchGitLabProject(&location, gitIgnore, method, apiURL, gitlabToken, concurrency, includeGit, includeNonText, verbose)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching GitLab project: %v\n", err)
+				return
+			}
+
+			if outputName == "" {
+				outputName = strings.ReplaceAll(location.Project, "/", "_")
+				if location.Ref != "" {
+					outputName += "_" + strings.ReplaceAll(location.Ref, "/", "_")
+				}
+				if location.Path != "" {
+					outputName += "_" + strings.ReplaceAll(location.Path, "/", "_")
+				}
+			}
+
+			tokenizer, err := utils.GetTokenizer("approx")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
+				return
+			}
+
+			outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
+				return
+			}
+
+			for _, outputPath := range outputPaths {
+				fmt.Printf("Output file created successfully: %s\n", outputPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&projectURL, "url", "u", "", "GitLab project URL or path (e.g., group/subgroup/project)")
+	cmd.Flags().StringVarP(&outputType, "type", "t", "md", "Output type: json or md")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
+	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
+	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
+	cmd.Flags().StringVarP(&ref, "ref", "r", "", "Branch, tag or commit SHA to fetch (default: the default branch or the ref in the URL)")
+	cmd.Flags().StringVarP(&method, "method", "m", utils.FetchMethodAuto, "Fetch method: auto (git if installed, else tarball), git, tarball (repository archive) or api (repository tree)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Number of concurrent requests of the api method")
+	cmd.Flags().StringVar(&gitlabHost, "gitlab-host", utils.DefaultGitLabHost, "Host of group/project short forms, e.g. a self-managed GitLab")
+	cmd.Flags().StringVar(&apiURL, "api-url", "", "Base URL of the GitLab REST API (default: https://<host>/api/v4)")
+	cmd.Flags().StringVarP(&gitlabToken, "token", "k", "", "GitLab access token (default: from GITLAB_TOKEN or git credentials)")
+	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
+	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
+	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Report the remaining GitLab API quota after every request")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
+
+	cmd.MarkFlagRequired("url")
+
+	return cmd
+}
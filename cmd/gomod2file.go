@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gusanmaz/onefile/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewGoMod2FileCmd() *cobra.Command {
+	var modulePath, version, proxy, goModPath, goSumPath, outputType, outputDir, outputName string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens int
+	var includeGit, includeNonText, showExcluded bool
+	var cmd = &cobra.Command{
+		Use:   "gomod2file",
+		Short: "Fetch a Go module and save as JSON or Markdown",
+		Long: `Fetch a version of a Go module from a module proxy and save its structure
+and contents as JSON or Markdown.
+
+The module is given by its path, optionally with a version:
+- github.com/spf13/cobra (the latest release)
+- github.com/spf13/cobra@v1.8.0 or --version v1.8.0
+- --go-mod go.mod (the version that go.mod requires)
+
+Proxies are taken from --proxy, GOPROXY or the go command's default, as a
+list separated by "," (try the next proxy if a module is missing) or "|" (try
+the next proxy on any error). Modules matching GONOPROXY or GOPRIVATE, and
+lists that get to "direct", fail, since fetching from version control is not
+supported.
+
+With --go-sum, the downloaded zip must match the hash recorded in that go.sum.
+The checksum database (GOSUMDB) is not consulted, so without --go-sum a
+warning is printed unless GOSUMDB=off or the module matches GONOSUMDB or
+GOPRIVATE, for which the go command skips the database too.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
+			}
+
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
+				return
+			}
+
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
+
+			if i := strings.LastIndex(modulePath, "@"); i >= 0 {
+				if version == "" {
+					version = modulePath[i+1:]
+				}
+				modulePath = modulePath[:i]
+			}
+			if version == "" && goModPath != "" {
+				version, err = utils.GoModVersion(goModPath, modulePath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading go.mod: %v\n", err)
+					return
+				}
+			}
+
+			projectData, err := utils.FetchGoModule(proxy, modulePath, version, goSumPath, gitIgnore, includeGit, includeNonText)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching Go module: %v\n", err)
+				return
+			}
+
+			if outputName == "" {
+				outputName = strings.ReplaceAll(modulePath, "/", "_") + "_" + projectData.Ref
+			}
+
+			// Create output directory if it doesn't exist
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+				return
+			}
+
+			tokenizer, err := utils.GetTokenizer("approx")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
+				return
+			}
+
+			outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
+				return
+			}
+
+			for _, outputPath := range outputPaths {
+				fmt.Printf("Output file created successfully: %s\n", outputPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&modulePath, "module", "m", "", "Go module path, optionally with @version")
+	cmd.Flags().StringVar(&version, "version", "", "Version to fetch (default: latest)")
+	cmd.Flags().StringVar(&goModPath, "go-mod", "", "Fetch the version of the module that this go.mod file requires")
+	cmd.Flags().StringVar(&proxy, "proxy", "", "Module proxy list in GOPROXY format (default: $GOPROXY or "+utils.DefaultGoProxy+")")
+	cmd.Flags().StringVar(&goSumPath, "go-sum", "", "Verify the module zip against the hash in this go.sum file")
+	cmd.Flags().StringVarP(&outputType, "type", "t", "md", "Output type: json or md")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
+	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
+	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
+	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
+	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
+	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
+
+	cmd.MarkFlagRequired("module")
+
+	return cmd
+}
@@ -12,11 +12,14 @@ import (
 
 func NewJSON2MDCmd() *cobra.Command {
 	var jsonPath, outputPath string
+	var excludePatterns, includePatterns []string
 	var includeGit, includeNonText, showExcluded bool
 	var cmd = &cobra.Command{
 		Use:   "json2md",
 		Short: "Convert JSON to Markdown",
-		Long:  `Convert a JSON file containing project structure to a Markdown file.`,
+		Long: `Convert a JSON file containing project structure to a Markdown file.
+Exclude (-e) and include (-i) patterns work as in dump and leave out the
+contents of the files they filter.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			data, err := ioutil.ReadFile(jsonPath)
 			if err != nil {
@@ -31,6 +34,23 @@ func NewJSON2MDCmd() *cobra.Command {
 				return
 			}
 
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
+			}
+
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
+				return
+			}
+
+			if len(parsedExcludePatterns) > 0 || len(parsedIncludePatterns) > 0 {
+				gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
+				projectData = utils.FilterProject(projectData, gitIgnore)
+			}
+
 			markdown := utils.GenerateMarkdown(projectData, includeGit, includeNonText, showExcluded)
 
 			err = ioutil.WriteFile(outputPath, []byte(markdown), 0644)
@@ -45,6 +65,8 @@ func NewJSON2MDCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&jsonPath, "json", "j", "project_data.json", "Input JSON file")
 	cmd.Flags().StringVarP(&outputPath, "output", "o", "project_structure.md", "Output Markdown file")
+	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
 	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
 	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
 	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gusanmaz/onefile/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewMD2JSONCmd() *cobra.Command {
+	var mdPath, outputPath string
+	var cmd = &cobra.Command{
+		Use:   "md2json",
+		Short: "Convert Markdown to JSON",
+		Long: `Convert a Markdown file in the format produced by dump, json2md, github2file
+or pypi2file back to a JSON file containing the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := ioutil.ReadFile(mdPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading Markdown file: %v\n", err)
+				return
+			}
+
+			projectData, err := utils.ParseMarkdown(string(data))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing Markdown: %v\n", err)
+				return
+			}
+
+			err = utils.SaveAsJSON(projectData, outputPath, true, true)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON file: %v\n", err)
+				return
+			}
+
+			fmt.Printf("JSON generated at %s\n", outputPath)
+		},
+	}
+
+	cmd.Flags().StringVarP(&mdPath, "md", "m", "project_structure.md", "Input Markdown file")
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "project_data.json", "Output JSON file")
+
+	return cmd
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gusanmaz/onefile/utils"
+	"github.com/spf13/cobra"
+)
+
+func NewNPM2FileCmd() *cobra.Command {
+	var packageName, version, registryURL, outputType, outputDir, outputName string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens int
+	var includeGit, includeNonText, showExcluded bool
+	var cmd = &cobra.Command{
+		Use:   "npm2file",
+		Short: "Fetch an npm package and save as JSON or Markdown",
+		Long: `Fetch an npm package and save its structure and contents as JSON or Markdown.
+
+The package is given by name, optionally with a version or dist-tag:
+- react (the latest dist-tag)
+- react@18.2.0 or --version 18.2.0
+- @types/node@next
+
+Packages are resolved in the registry given by --registry, e.g. a private
+registry or a mirror, and their published tarball is dumped without the
+leading package/ directory.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
+			}
+
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
+				return
+			}
+
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
+
+			name, specVersion := utils.ParseNPMSpec(packageName)
+			if version == "" {
+				version = specVersion
+			}
+
+			projectData, err := utils.FetchNPMPackage(registryURL, name, version, gitIgnore, includeGit, includeNonText)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching npm package: %v\n", err)
+				return
+			}
+
+			if outputName == "" {
+				outputName = strings.ReplaceAll(strings.TrimPrefix(name, "@"), "/", "_") + "_" + projectData.Ref
+			}
+
+			// Create output directory if it doesn't exist
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
+				return
+			}
+
+			tokenizer, err := utils.GetTokenizer("approx")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
+				return
+			}
+
+			outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
+				return
+			}
+
+			for _, outputPath := range outputPaths {
+				fmt.Printf("Output file created successfully: %s\n", outputPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&packageName, "package", "p", "", "npm package name, optionally with @version or @dist-tag")
+	cmd.Flags().StringVar(&version, "version", "", "Version or dist-tag to fetch (default: latest)")
+	cmd.Flags().StringVar(&registryURL, "registry", utils.DefaultNPMRegistry, "URL of the npm registry")
+	cmd.Flags().StringVarP(&outputType, "type", "t", "md", "Output type: json or md")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
+	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
+	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
+	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
+	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
+	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
+
+	cmd.MarkFlagRequired("package")
+
+	return cmd
+}
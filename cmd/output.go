@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gusanmaz/onefile/utils"
+)
+
+// saveOutput writes projectData to basePath.<outputType>, or to numbered
+// basePath.partN.<outputType> files when chunkBytes or chunkTokens is set, and
+// returns the paths it wrote.
+func saveOutput(projectData utils.ProjectData, basePath, outputType string, includeGit, includeNonText, showExcluded bool, chunkBytes, chunkTokens int, tokenizer utils.Tokenizer) ([]string, error) {
+	if outputType != "json" && outputType != "md" {
+		return nil, fmt.Errorf("invalid output type %q, use 'json' or 'md'", outputType)
+	}
+
+	if chunkBytes <= 0 && chunkTokens <= 0 {
+		outputPath := basePath + "." + outputType
+		var err error
+		if outputType == "json" {
+			err = utils.SaveAsJSON(projectData, outputPath, includeGit, includeNonText)
+		} else {
+			err = utils.SaveAsMarkdown(projectData, outputPath, includeGit, includeNonText, showExcluded)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{outputPath}, nil
+	}
+
+	limit, size := chunkBytes, utils.ByteSize
+	if chunkTokens > 0 {
+		limit, size = chunkTokens, tokenizer.CountTokens
+	}
+
+	var parts []string
+	var err error
+	if outputType == "json" {
+		parts, err = utils.SplitJSON(projectData, limit, size, includeGit, includeNonText)
+	} else {
+		parts, err = utils.SplitMarkdown(projectData, limit, size, includeGit, includeNonText, showExcluded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var outputPaths []string
+	for i, part := range parts {
+		outputPath := fmt.Sprintf("%s.part%d.%s", basePath, i+1, outputType)
+		if err := ioutil.WriteFile(outputPath, []byte(part), 0644); err != nil {
+			return nil, err
+		}
+		outputPaths = append(outputPaths, outputPath)
+	}
+	return outputPaths, nil
+}
+
+// streamOutput writes the project produced by stream, such as
+// utils.StreamProject, straight into basePath.<outputType> without holding its
+// contents in memory.
+func streamOutput(basePath, outputType string, includeGit, includeNonText, showExcluded bool, stream func(w utils.ProjectWriter) error) error {
+	if outputType != "json" && outputType != "md" {
+		return fmt.Errorf("invalid output type %q, use 'json' or 'md'", outputType)
+	}
+
+	f, err := os.Create(basePath + "." + outputType)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buffered := bufio.NewWriter(f)
+	var w utils.ProjectWriter
+	if outputType == "json" {
+		w = utils.NewJSONWriter(buffered, includeGit, includeNonText)
+	} else {
+		w = utils.NewMarkdownWriter(buffered, includeGit, includeNonText, showExcluded)
+	}
+
+	if err := stream(w); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/gusanmaz/onefile/utils"
+)
+
+// parsePatternFlags splits the values of a repeatable pattern flag such as
+// --exclude or --include on whitespace and expands @file references.
+func parsePatternFlags(values []string) ([]string, error) {
+	var processedPatterns []string
+	for _, value := range values {
+		processedPatterns = append(processedPatterns, strings.Fields(value)...)
+	}
+	return utils.ParsePatterns(processedPatterns)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/gusanmaz/onefile/utils"
 	"github.com/spf13/cobra"
@@ -12,27 +11,30 @@ import (
 
 func NewPyPI2FileCmd() *cobra.Command {
 	var packageName, outputType, outputDir, outputName string
-	var excludePatterns []string
+	var excludePatterns, includePatterns []string
+	var chunkBytes, chunkTokens int
 	var includeGit, includeNonText, showExcluded bool
 	var cmd = &cobra.Command{
 		Use:   "pypi2file",
 		Short: "Fetch a PyPI package and save as JSON or Markdown",
-		Long:  `Fetch a PyPI package and save its structure and contents as JSON or Markdown.`,
+		Long: `Fetch a PyPI package and save its structure and contents as JSON or Markdown.
+
+With --chunk-bytes or --chunk-tokens, the output is split into numbered files
+(name.part1.md, name.part2.md, ...) that each repeat the project structure.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			// Process exclude patterns
-			var processedPatterns []string
-			for _, pattern := range excludePatterns {
-				patterns := strings.Fields(pattern)
-				processedPatterns = append(processedPatterns, patterns...)
+			parsedExcludePatterns, err := parsePatternFlags(excludePatterns)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				return
 			}
 
-			parsedExcludePatterns, err := utils.ParsePatterns(processedPatterns)
+			parsedIncludePatterns, err := parsePatternFlags(includePatterns)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error parsing exclude patterns: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error parsing include patterns: %v\n", err)
 				return
 			}
 
-			gitIgnore := utils.CreateGitIgnoreMatcher(parsedExcludePatterns)
+			gitIgnore := utils.CreatePathMatcher(utils.CreateGitIgnoreMatcher(parsedExcludePatterns), parsedIncludePatterns)
 
 			projectData, err := utils.FetchPyPIPackage(packageName, gitIgnore, includeGit, includeNonText)
 			if err != nil {
@@ -44,29 +46,27 @@ func NewPyPI2FileCmd() *cobra.Command {
 				outputName = packageName
 			}
 
-			outputPath := filepath.Join(outputDir, outputName+"."+outputType)
-
 			// Create output directory if it doesn't exist
 			if err := os.MkdirAll(outputDir, 0755); err != nil {
 				fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
 				return
 			}
 
-			if outputType == "json" {
-				err = utils.SaveAsJSON(projectData, outputPath, includeGit, includeNonText)
-			} else if outputType == "md" {
-				err = utils.SaveAsMarkdown(projectData, outputPath, includeGit, includeNonText, showExcluded)
-			} else {
-				fmt.Fprintf(os.Stderr, "Invalid output type. Use 'json' or 'md'\n")
+			tokenizer, err := utils.GetTokenizer("approx")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error selecting tokenizer: %v\n", err)
 				return
 			}
 
+			outputPaths, err := saveOutput(projectData, filepath.Join(outputDir, outputName), outputType, includeGit, includeNonText, showExcluded, chunkBytes, chunkTokens, tokenizer)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error saving output: %v\n", err)
 				return
 			}
 
-			fmt.Printf("Output file created successfully: %s\n", outputPath)
+			for _, outputPath := range outputPaths {
+				fmt.Printf("Output file created successfully: %s\n", outputPath)
+			}
 		},
 	}
 
@@ -75,9 +75,12 @@ func NewPyPI2FileCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&outputDir, "output-dir", "d", ".", "Output directory")
 	cmd.Flags().StringVarP(&outputName, "output-name", "n", "", "Output file name (without extension)")
 	cmd.Flags().StringArrayVarP(&excludePatterns, "exclude", "e", []string{}, "Patterns to exclude files (Use @ for file-based patterns, e.g., @.gitignore)")
+	cmd.Flags().StringArrayVarP(&includePatterns, "include", "i", []string{}, "Patterns of the only files to include (Use @ for file-based patterns); excludes take precedence")
 	cmd.Flags().BoolVar(&includeGit, "include-git", false, "Include .git files and directories")
 	cmd.Flags().BoolVar(&includeNonText, "include-non-text", false, "Include non-text files")
 	cmd.Flags().BoolVar(&showExcluded, "show-excluded", false, "Show excluded files in project structure and shell commands")
+	cmd.Flags().IntVar(&chunkBytes, "chunk-bytes", 0, "Split the output into numbered files of at most this many bytes")
+	cmd.Flags().IntVar(&chunkTokens, "chunk-tokens", 0, "Split the output into numbered files of at most this many tokens")
 
 	cmd.MarkFlagRequired("package")
 
@@ -11,26 +11,44 @@ import (
 )
 
 func NewReconstructCmd() *cobra.Command {
-	var jsonPath, outputPath string
+	var jsonPath, mdPath, outputPath string
+	var allowUnsafePaths bool
 	var cmd = &cobra.Command{
 		Use:   "reconstruct",
-		Short: "Reconstruct a project from JSON",
-		Long:  `Reconstruct a project structure and file contents from a JSON file.`,
+		Short: "Reconstruct a project from JSON or Markdown",
+		Long: `Reconstruct a project structure and file contents from a JSON file, or from a
+Markdown file in the format produced by json2md when --from-md is given.
+Entries with absolute paths, paths escaping the output directory, duplicate
+entries and writes through symlinks are rejected unless --allow-unsafe-paths is given.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			data, err := ioutil.ReadFile(jsonPath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading JSON file: %v\n", err)
-				return
-			}
-
 			var projectData utils.ProjectData
-			err = json.Unmarshal(data, &projectData)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error unmarshaling JSON: %v\n", err)
-				return
+			if mdPath != "" {
+				data, err := ioutil.ReadFile(mdPath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading Markdown file: %v\n", err)
+					return
+				}
+
+				projectData, err = utils.ParseMarkdown(string(data))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error parsing Markdown: %v\n", err)
+					return
+				}
+			} else {
+				data, err := ioutil.ReadFile(jsonPath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading JSON file: %v\n", err)
+					return
+				}
+
+				err = json.Unmarshal(data, &projectData)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error unmarshaling JSON: %v\n", err)
+					return
+				}
 			}
 
-			err = utils.ReconstructProject(projectData, outputPath)
+			err := utils.ReconstructProject(projectData, outputPath, allowUnsafePaths)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error reconstructing project: %v\n", err)
 				return
@@ -41,7 +59,9 @@ func NewReconstructCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&jsonPath, "json", "j", "project_data.json", "Input JSON file")
+	cmd.Flags().StringVarP(&mdPath, "from-md", "m", "", "Input Markdown file (used instead of --json)")
 	cmd.Flags().StringVarP(&outputPath, "output", "o", "reconstructed_project", "Output directory")
+	cmd.Flags().BoolVar(&allowUnsafePaths, "allow-unsafe-paths", false, "Skip path validation and write entries even if they escape the output directory")
 
 	return cmd
 }
@@ -14,18 +14,30 @@ func main() {
 		Short: "A tool for project file management and repository fetching",
 		Long: `onefile is a versatile command-line tool that allows you to:
 - Dump local project structures to JSON or Markdown
-- Reconstruct projects from JSON
+- Reconstruct projects from JSON or Markdown
 - Convert JSON project representations to Markdown
+- Convert Markdown project representations back to JSON
 - Fetch GitHub repositories and save them as JSON or Markdown
-- Fetch PyPI packages and save them as JSON or Markdown`,
+- Fetch GitLab projects and save them as JSON or Markdown
+- Fetch any git repository and save it as JSON or Markdown
+- Fetch PyPI packages and save them as JSON or Markdown
+- Fetch npm packages and save them as JSON or Markdown
+- Fetch Go modules and save them as JSON or Markdown
+- Fetch Rust crates and save them as JSON or Markdown`,
 	}
 
 	rootCmd.AddCommand(
 		cmd.NewDumpCmd(),
 		cmd.NewReconstructCmd(),
 		cmd.NewJSON2MDCmd(),
+		cmd.NewMD2JSONCmd(),
 		cmd.NewGitHub2FileCmd(),
+		cmd.NewGitLab2FileCmd(),
+		cmd.NewGit2FileCmd(),
 		cmd.NewPyPI2FileCmd(),
+		cmd.NewNPM2FileCmd(),
+		cmd.NewGoMod2FileCmd(),
+		cmd.NewCrate2FileCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
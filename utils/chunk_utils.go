@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ByteSize measures text in bytes, for splitting output by size on disk.
+func ByteSize(text string) int {
+	return len(text)
+}
+
+// SplitMarkdown renders projectData as a series of Markdown documents that are
+// each at most limit in size, as measured by size (bytes or tokens). Every part
+// starts with a chunk index listing its files and repeats the project tree and
+// shell commands. A file is only split across parts when it exceeds the limit on
+// its own; its segments are labelled "(part k of m)" so ParseMarkdown can join
+// them again.
+func SplitMarkdown(projectData ProjectData, limit int, size func(string) int, includeGit, includeNonText, showExcluded bool) ([]string, error) {
+	structure := generateMarkdownStructure(projectData, includeGit, includeNonText, showExcluded) + "## File Contents\n\n"
+
+	// Reserve room for the widest chunk numbers the header can realistically show
+	capacity := limit - size(markdownChunkHeader(99999, 99999, nil)) - size(structure)
+	if capacity <= 0 {
+		return nil, fmt.Errorf("chunk limit %d is too small for the project structure", limit)
+	}
+
+	var sections []chunkSection
+	for _, file := range projectData.Files {
+		if file.Content == "" || !isOutputFile(file, includeGit, includeNonText) {
+			continue
+		}
+		cost := size(generateMarkdownFile(file, "")) + size(markdownChunkIndexLine(file.Path, ""))
+		if cost <= capacity {
+			sections = append(sections, chunkSection{file: file, cost: cost})
+			continue
+		}
+		segments, err := splitFileToFit(file, capacity, func(segment FileData) int {
+			label := " (part 99999 of 99999)"
+			return size(generateMarkdownFile(segment, label)) + size(markdownChunkIndexLine(segment.Path, label))
+		})
+		if err != nil {
+			return nil, err
+		}
+		for k, segment := range segments {
+			label := fmt.Sprintf(" (part %d of %d)", k+1, len(segments))
+			sections = append(sections, chunkSection{file: segment, label: label, cost: capacity})
+		}
+	}
+
+	parts := packChunkSections(sections, capacity)
+	documents := make([]string, len(parts))
+	for i, part := range parts {
+		var md strings.Builder
+		md.WriteString(markdownChunkHeader(i+1, len(parts), part))
+		md.WriteString(structure)
+		for _, section := range part {
+			md.WriteString(generateMarkdownFile(section.file, section.label))
+		}
+		documents[i] = md.String()
+	}
+	return documents, nil
+}
+
+// SplitJSON renders projectData as a series of JSON documents that are each at
+// most limit in size. Every part is a complete ProjectData with all directories,
+// a share of the files and a chunk index listing them. As with SplitMarkdown, a
+// file is only split across parts when it exceeds the limit on its own; its
+// segments carry their numbers, and the index labels them "(part k of m)".
+func SplitJSON(projectData ProjectData, limit int, size func(string) int, includeGit, includeNonText bool) ([]string, error) {
+	structure := projectData
+	structure.Files = nil
+	// Reserve room for the widest chunk numbers and the brackets of the index
+	structure.Chunk = &ChunkInfo{Part: 99999, Total: 99999, Files: []string{""}}
+	base, err := GenerateJSON(structure, includeGit, includeNonText)
+	if err != nil {
+		return nil, err
+	}
+	capacity := limit - size(string(base))
+	if capacity <= 0 {
+		return nil, fmt.Errorf("chunk limit %d is too small for the project structure", limit)
+	}
+
+	// The cost of a file is its entry in the files list and in the chunk index
+	cost := func(file FileData, label string) (int, error) {
+		data, err := json.MarshalIndent(file, "    ", "  ")
+		if err != nil {
+			return 0, err
+		}
+		entry, err := json.Marshal(file.Path + label)
+		if err != nil {
+			return 0, err
+		}
+		// Indentation and the separating commas
+		return size(string(data)) + 6 + size(string(entry)) + size(",\n      "), nil
+	}
+
+	var sections []chunkSection
+	for _, file := range projectData.Files {
+		if !isOutputFile(file, includeGit, includeNonText) {
+			continue
+		}
+		fileCost, err := cost(file, "")
+		if err != nil {
+			return nil, err
+		}
+		if fileCost <= capacity || file.Content == "" {
+			sections = append(sections, chunkSection{file: file, cost: fileCost})
+			continue
+		}
+		var costErr error
+		segments, err := splitFileToFit(file, capacity, func(segment FileData) int {
+			segment.Segment = &FileSegment{Part: 99999, Total: 99999}
+			segmentCost, err := cost(segment, " (part 99999 of 99999)")
+			if err != nil {
+				costErr = err
+			}
+			return segmentCost
+		})
+		if costErr != nil {
+			return nil, costErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, segment := range segments {
+			segment.Segment = &FileSegment{Part: k + 1, Total: len(segments)}
+			label := fmt.Sprintf(" (part %d of %d)", k+1, len(segments))
+			sections = append(sections, chunkSection{file: segment, label: label, cost: capacity})
+		}
+	}
+
+	parts := packChunkSections(sections, capacity)
+	documents := make([]string, len(parts))
+	for i, part := range parts {
+		partData := projectData
+		partData.Files = nil
+		partData.Chunk = &ChunkInfo{Part: i + 1, Total: len(parts), Files: []string{}}
+		for _, section := range part {
+			partData.Files = append(partData.Files, section.file)
+			partData.Chunk.Files = append(partData.Chunk.Files, section.file.Path+section.label)
+		}
+		data, err := GenerateJSON(partData, includeGit, includeNonText)
+		if err != nil {
+			return nil, err
+		}
+		documents[i] = string(data)
+	}
+	return documents, nil
+}
+
+type chunkSection struct {
+	file  FileData
+	label string
+	cost  int
+}
+
+// packChunkSections groups sections in order into parts whose total cost stays
+// within capacity. It always returns at least one part.
+func packChunkSections(sections []chunkSection, capacity int) [][]chunkSection {
+	parts := [][]chunkSection{nil}
+	used := 0
+	for _, section := range sections {
+		current := len(parts) - 1
+		if len(parts[current]) > 0 && used+section.cost > capacity {
+			parts = append(parts, nil)
+			current++
+			used = 0
+		}
+		parts[current] = append(parts[current], section)
+		used += section.cost
+	}
+	return parts
+}
+
+func markdownChunkHeader(part, total int, sections []chunkSection) string {
+	var md strings.Builder
+	md.WriteString(fmt.Sprintf("# Chunk %d of %d\n\n", part, total))
+	md.WriteString("Files in this chunk:\n\n")
+	for _, section := range sections {
+		md.WriteString(markdownChunkIndexLine(section.file.Path, section.label))
+	}
+	md.WriteString("\n")
+	return md.String()
+}
+
+func markdownChunkIndexLine(path, label string) string {
+	return fmt.Sprintf("- %s%s\n", path, label)
+}
+
+// splitFileToFit cuts the content of file into segments whose cost stays within
+// capacity, preferring to cut at line breaks.
+func splitFileToFit(file FileData, capacity int, cost func(FileData) int) ([]FileData, error) {
+	content := file.Content
+	if file.Encoding == EncodingBase64 {
+		// Cut at line boundaries of the wrapped form so every segment decodes on its own
+		content = wrapLines(content, 76) + "\n"
+	}
+
+	var segments []FileData
+	for content != "" {
+		n := longestFittingPrefix(content, func(prefix string) bool {
+			segment := file
+			segment.Content = prefix
+			return cost(segment) <= capacity
+		})
+		if n == 0 {
+			return nil, fmt.Errorf("chunk limit is too small to hold any part of %s", file.Path)
+		}
+		segment := file
+		segment.Content = content[:n]
+		if file.Encoding == EncodingBase64 {
+			segment.Content = strings.Join(strings.Fields(segment.Content), "")
+		}
+		segments = append(segments, segment)
+		content = content[n:]
+	}
+	// The diff is only rendered after the last segment; its cost was counted
+	// for every segment, which only makes the segments smaller
+	for i := 0; i < len(segments)-1; i++ {
+		segments[i].Diff = ""
+	}
+	return segments, nil
+}
+
+// longestFittingPrefix returns the length of the longest prefix of text ending at
+// a line break for which fits is true, or, if not even the first line fits, the
+// longest fitting prefix of that line cut at a character boundary.
+func longestFittingPrefix(text string, fits func(string) bool) int {
+	var cuts []int
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			cuts = append(cuts, i+1)
+		}
+	}
+	if len(cuts) == 0 || cuts[len(cuts)-1] != len(text) {
+		cuts = append(cuts, len(text))
+	}
+
+	best := searchFittingCut(cuts, func(cut int) bool { return fits(text[:cut]) })
+	if best > 0 {
+		return best
+	}
+
+	var runeCuts []int
+	for i := range text[:cuts[0]] {
+		if i > 0 {
+			runeCuts = append(runeCuts, i)
+		}
+	}
+	return searchFittingCut(runeCuts, func(cut int) bool { return fits(text[:cut]) })
+}
+
+// searchFittingCut returns the largest of the ascending cuts for which fits is
+// true, or 0 if there is none.
+func searchFittingCut(cuts []int, fits func(int) bool) int {
+	low, high := 0, len(cuts)
+	for low < high {
+		mid := (low + high) / 2
+		if fits(cuts[mid]) {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	if low == 0 {
+		return 0
+	}
+	return cuts[low-1]
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitMarkdown(t *testing.T) {
+	projectData := ProjectData{
+		Files: []FileData{
+			{Path: "a.go", Content: strings.Repeat("// a\n", 100)},
+			{Path: "b.go", Content: strings.Repeat("// b\n", 100)},
+			{Path: "big.go", Content: strings.Repeat("// big\n", 1000)},
+		},
+	}
+
+	parts, err := SplitMarkdown(projectData, 2000, ByteSize, false, false, false)
+	if err != nil {
+		t.Fatalf("SplitMarkdown failed: %v", err)
+	}
+	if len(parts) < 4 {
+		t.Errorf("SplitMarkdown returned %d parts; want big.go split across several parts", len(parts))
+	}
+	for i, part := range parts {
+		if len(part) > 2000 {
+			t.Errorf("Part %d is %d bytes; want at most 2000", i+1, len(part))
+		}
+		if !strings.HasPrefix(part, fmt.Sprintf("# Chunk %d of %d\n", i+1, len(parts))) {
+			t.Errorf("Part %d does not start with its chunk header", i+1)
+		}
+	}
+
+	parsed, err := ParseMarkdown(strings.Join(parts, ""))
+	if err != nil {
+		t.Fatalf("ParseMarkdown failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Files, projectData.Files) {
+		t.Errorf("Joined chunks do not reproduce the original files")
+	}
+}
+
+func TestSplitJSON(t *testing.T) {
+	projectData := ProjectData{
+		Directories: []string{"docs"},
+		Files: []FileData{
+			{Path: "a.go", Content: strings.Repeat("// a\n", 100)},
+			{Path: "b.go", Content: strings.Repeat("// b\n", 100)},
+			{Path: "big.go", Content: strings.Repeat("// big\n", 1000)},
+		},
+	}
+
+	parts, err := SplitJSON(projectData, 2000, ByteSize, false, false)
+	if err != nil {
+		t.Fatalf("SplitJSON failed: %v", err)
+	}
+	if len(parts) < 4 {
+		t.Errorf("SplitJSON returned %d parts; want big.go split across several parts", len(parts))
+	}
+
+	var joined []FileData
+	for i, part := range parts {
+		if len(part) > 2000 {
+			t.Errorf("Part %d is %d bytes; want at most 2000", i+1, len(part))
+		}
+		var partData ProjectData
+		if err := json.Unmarshal([]byte(part), &partData); err != nil {
+			t.Fatalf("Part %d is not valid JSON: %v", i+1, err)
+		}
+		if partData.Chunk == nil || partData.Chunk.Part != i+1 || partData.Chunk.Total != len(parts) {
+			t.Fatalf("Part %d has chunk header %+v", i+1, partData.Chunk)
+		}
+		if !reflect.DeepEqual(partData.Directories, projectData.Directories) {
+			t.Errorf("Part %d has directories %v", i+1, partData.Directories)
+		}
+
+		for j, file := range partData.Files {
+			label := ""
+			if file.Segment != nil {
+				label = fmt.Sprintf(" (part %d of %d)", file.Segment.Part, file.Segment.Total)
+			}
+			if j >= len(partData.Chunk.Files) || partData.Chunk.Files[j] != file.Path+label {
+				t.Errorf("Part %d lists %v for file %s%s", i+1, partData.Chunk.Files, file.Path, label)
+			}
+
+			// Segments of a file are joined in order
+			if n := len(joined); file.Segment != nil && file.Segment.Part > 1 && n > 0 && joined[n-1].Path == file.Path {
+				joined[n-1].Content += file.Content
+				continue
+			}
+			file.Segment = nil
+			joined = append(joined, file)
+		}
+	}
+	if !reflect.DeepEqual(joined, projectData.Files) {
+		t.Errorf("Joined chunks do not reproduce the original files")
+	}
+
+	var lastPart ProjectData
+	json.Unmarshal([]byte(parts[len(parts)-1]), &lastPart)
+	outputPath, err := ioutil.TempDir("", "onefile-segment-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outputPath)
+	if err := ReconstructProject(lastPart, outputPath, false); err == nil || !strings.Contains(err.Error(), "merge the parts first") {
+		t.Errorf("ReconstructProject of a part with a segment = %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sabhiram/go-gitignore"
+	"github.com/schollz/progressbar/v3"
+)
+
+// DefaultCrateIndex is the sparse index of crates.io.
+const DefaultCrateIndex = "https://index.crates.io"
+
+// crateIndexConfig is the config.json at the root of a registry index.
+type crateIndexConfig struct {
+	// DL is the download URL, either a template with {crate}, {version},
+	// {prefix}, {lowerprefix} and {sha256-checksum} markers or a base URL
+	// that /{crate}/{version}/download is appended to
+	DL string `json:"dl"`
+}
+
+// crateIndexEntry is one line of a crate's index file, describing a version.
+type crateIndexEntry struct {
+	Name     string `json:"name"`
+	Version  string `json:"vers"`
+	Checksum string `json:"cksum"`
+	Yanked   bool   `json:"yanked"`
+}
+
+// FetchCrate downloads a version of a crate from the registry whose sparse
+// index is at indexURL, or from crates.io if it is empty. A "sparse+" prefix,
+// as in Cargo's configuration, is accepted. version is an exact version or
+// "latest", the default, which picks the highest release that is not yanked.
+// The archive is verified against the checksum in the index and dumped without
+// its leading name-version/ directory; the download URL and the version are
+// recorded as the source and ref of the result.
+func FetchCrate(indexURL, crateName, version string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	if indexURL == "" {
+		indexURL = DefaultCrateIndex
+	}
+	if version == "" {
+		version = "latest"
+	}
+	client := newAPIClient("crate registry", strings.TrimPrefix(indexURL, "sparse+"), false)
+
+	var config crateIndexConfig
+	if err := client.getJSON(client.baseURL+"/config.json", &config); err != nil {
+		return ProjectData{}, fmt.Errorf("reading registry configuration: %v", err)
+	}
+	if config.DL == "" {
+		return ProjectData{}, fmt.Errorf("registry index %s has no download URL", indexURL)
+	}
+
+	entries, err := readCrateIndex(client, crateName)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	entry, err := selectCrateVersion(entries, version)
+	if err != nil {
+		return ProjectData{}, fmt.Errorf("%v of %s", err, crateName)
+	}
+
+	downloadURL := crateDownloadURL(config.DL, entry)
+	projectData, err := downloadCrate(downloadURL, entry.Checksum, client, gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	projectData.Source = downloadURL
+	projectData.Ref = entry.Version
+
+	return projectData, nil
+}
+
+// readCrateIndex reads the index file of a crate, one JSON entry per line.
+func readCrateIndex(client *apiClient, crateName string) ([]crateIndexEntry, error) {
+	resp, err := client.get(client.baseURL + "/" + crateIndexPath(crateName))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Registries answer 404, or 403 when served from a bucket, for unknown crates
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("crate %s not found in %s", crateName, client.baseURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, client.statusError(resp)
+	}
+
+	var entries []crateIndexEntry
+	scanner := bufio.NewScanner(resp.Body)
+	// Entries list every dependency and feature, so lines can be long
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry crateIndexEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("parsing index entry of %s: %v", crateName, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// selectCrateVersion returns the entry of version, or for "latest" of the
+// highest version that is not yanked, preferring releases to prereleases.
+func selectCrateVersion(entries []crateIndexEntry, version string) (crateIndexEntry, error) {
+	if version != "latest" {
+		for _, entry := range entries {
+			if entry.Version == version {
+				return entry, nil
+			}
+		}
+		return crateIndexEntry{}, fmt.Errorf("version %s not found", version)
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		if !entry.Yanked {
+			versions = append(versions, entry.Version)
+		}
+	}
+	latest := latestSemver(versions)
+	for _, entry := range entries {
+		if entry.Version == latest && !entry.Yanked {
+			return entry, nil
+		}
+	}
+	return crateIndexEntry{}, fmt.Errorf("no version that is not yanked found")
+}
+
+// crateIndexPrefix returns the directory of a crate's file in a registry
+// index: 1 or 2 for names of that length, 3/{first letter} for names of three
+// characters, otherwise the first two and the next two characters.
+func crateIndexPrefix(crateName string) string {
+	switch len(crateName) {
+	case 1, 2:
+		return fmt.Sprint(len(crateName))
+	case 3:
+		return "3/" + crateName[:1]
+	}
+	return crateName[:2] + "/" + crateName[2:4]
+}
+
+// crateIndexPath returns the path of a crate's file in a registry index,
+// which is lower case, as crate names are case-insensitive.
+func crateIndexPath(crateName string) string {
+	name := strings.ToLower(crateName)
+	return crateIndexPrefix(name) + "/" + name
+}
+
+// crateDownloadURL fills the dl template of a registry's configuration for a
+// version of a crate.
+func crateDownloadURL(dl string, entry crateIndexEntry) string {
+	markers := []string{"{crate}", "{version}", "{prefix}", "{lowerprefix}", "{sha256-checksum}"}
+	templated := false
+	for _, marker := range markers {
+		if strings.Contains(dl, marker) {
+			templated = true
+			break
+		}
+	}
+	if !templated {
+		return strings.TrimSuffix(dl, "/") + "/" + entry.Name + "/" + entry.Version + "/download"
+	}
+
+	prefix := crateIndexPrefix(entry.Name)
+	return strings.NewReplacer(
+		"{crate}", entry.Name,
+		"{version}", entry.Version,
+		"{prefix}", prefix,
+		"{lowerprefix}", strings.ToLower(prefix),
+		"{sha256-checksum}", entry.Checksum,
+	).Replace(dl)
+}
+
+// downloadCrate downloads and extracts a .crate archive, a gzipped tarball
+// of a single name-version/ directory, and checks its SHA-256 if the index
+// recorded one.
+func downloadCrate(url, checksum string, client *apiClient, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	resp, err := client.get(url)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ProjectData{}, client.statusError(resp)
+	}
+
+	hash := sha256.New()
+	bar := progressbar.DefaultBytes(resp.ContentLength, "Downloading crate")
+	body := io.TeeReader(io.TeeReader(resp.Body, hash), bar)
+	projectData, err := extractTarGz(body, 1, "", gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	// The tar reader stops at the end-of-archive marker, before the padding
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return ProjectData{}, err
+	}
+	bar.Finish()
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); checksum != "" && !strings.EqualFold(sum, checksum) {
+		return ProjectData{}, fmt.Errorf("checksum mismatch for %s: downloaded %s, index has %s", url, sum, checksum)
+	}
+
+	sort.Strings(projectData.Directories)
+	sort.Slice(projectData.Files, func(i, j int) bool {
+		return projectData.Files[i].Path < projectData.Files[j].Path
+	})
+	return projectData, nil
+}
+
+// ParseCrateSpec splits a crate spec such as serde@1.0.190 into the crate
+// name and the version, which is empty if the spec has none.
+func ParseCrateSpec(spec string) (string, string) {
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
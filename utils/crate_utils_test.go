@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCrateIndexLayout(t *testing.T) {
+	testCases := []struct {
+		name, path string
+	}{
+		{"a", "1/a"},
+		{"cc", "2/cc"},
+		{"Syn", "3/s/syn"},
+		{"serde_json", "se/rd/serde_json"},
+	}
+	for _, tc := range testCases {
+		if path := crateIndexPath(tc.name); path != tc.path {
+			t.Errorf("crateIndexPath(%q) = %q, want %q", tc.name, path, tc.path)
+		}
+	}
+
+	entry := crateIndexEntry{Name: "Serde", Version: "1.0.0", Checksum: "abc"}
+	if url := crateDownloadURL("https://static.crates.io/crates", entry); url != "https://static.crates.io/crates/Serde/1.0.0/download" {
+		t.Errorf("crateDownloadURL without markers = %s", url)
+	}
+	if url := crateDownloadURL("https://dl.example.com/{lowerprefix}/{prefix}/{crate}-{version}.crate?sum={sha256-checksum}", entry); url != "https://dl.example.com/se/rd/Se/rd/Serde-1.0.0.crate?sum=abc" {
+		t.Errorf("crateDownloadURL with markers = %s", url)
+	}
+}
+
+func TestFetchCrate(t *testing.T) {
+	archives := map[string][]byte{}
+	sums := map[string]string{}
+	for version, files := range map[string]map[string]string{
+		"0.1.0":        {"Cargo.toml": "[package]\nversion = \"0.1.0\"\n", "src/lib.rs": "pub fn one() {}\n"},
+		"0.2.0":        {"Cargo.toml": "[package]\nversion = \"0.2.0\"\n", "src/main.rs": "fn main() {}\n"},
+		"0.3.0-beta.1": {"Cargo.toml": "[package]\nversion = \"0.3.0-beta.1\"\n"},
+	} {
+		archives[version] = tarGz(t, "mycrate-"+version+"/", files)
+		sum := sha256.Sum256(archives[version])
+		sums[version] = hex.EncodeToString(sum[:])
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case path == "/config.json":
+			fmt.Fprintf(w, `{"dl": "%s/api/v1/crates", "api": "%s"}`, server.URL, server.URL)
+		case path == "/my/cr/mycrate":
+			fmt.Fprintf(w, "{\"name\":\"mycrate\",\"vers\":\"0.1.0\",\"cksum\":%q,\"yanked\":false}\n", sums["0.1.0"])
+			// The highest release is yanked and the checksum is wrong on purpose
+			fmt.Fprintf(w, "{\"name\":\"mycrate\",\"vers\":\"0.2.0\",\"cksum\":%q,\"yanked\":false}\n", sums["0.1.0"])
+			fmt.Fprintf(w, "{\"name\":\"mycrate\",\"vers\":\"0.2.1\",\"cksum\":\"\",\"yanked\":true}\n")
+			fmt.Fprintf(w, "{\"name\":\"mycrate\",\"vers\":\"0.3.0-beta.1\",\"cksum\":%q,\"yanked\":false}\n", sums["0.3.0-beta.1"])
+		case strings.HasPrefix(path, "/api/v1/crates/mycrate/") && strings.HasSuffix(path, "/download"):
+			w.Write(archives[strings.TrimSuffix(strings.TrimPrefix(path, "/api/v1/crates/mycrate/"), "/download")])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		version, resolved string
+		files             []string
+	}{
+		{"0.1.0", "0.1.0", []string{"Cargo.toml", "src/lib.rs"}},
+		{"0.3.0-beta.1", "0.3.0-beta.1", []string{"Cargo.toml"}},
+	}
+	for _, tc := range testCases {
+		projectData, err := FetchCrate("sparse+"+server.URL+"/", "mycrate", tc.version, CreateGitIgnoreMatcher(nil), false, false)
+		if err != nil {
+			t.Fatalf("FetchCrate(%q) failed: %v", tc.version, err)
+		}
+		if paths := getFilePaths(projectData.Files); !reflect.DeepEqual(paths, tc.files) {
+			t.Errorf("FetchCrate(%q) files = %v, want %v", tc.version, paths, tc.files)
+		}
+		if projectData.Ref != tc.resolved || projectData.Source != server.URL+"/api/v1/crates/mycrate/"+tc.resolved+"/download" {
+			t.Errorf("FetchCrate(%q) recorded %q %q", tc.version, projectData.Source, projectData.Ref)
+		}
+	}
+
+	// The latest release that is not yanked has a mismatching checksum
+	if _, err := FetchCrate(server.URL, "mycrate", "", CreateGitIgnoreMatcher(nil), false, false); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("FetchCrate of the latest version = %v", err)
+	}
+	if _, err := FetchCrate(server.URL, "mycrate", "9.0.0", CreateGitIgnoreMatcher(nil), false, false); err == nil {
+		t.Errorf("FetchCrate accepted a missing version")
+	}
+	if _, err := FetchCrate(server.URL, "missing", "", CreateGitIgnoreMatcher(nil), false, false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("FetchCrate of a missing crate = %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultGitHubHost is the host of github.com repositories.
+const DefaultGitHubHost = "github.com"
+
+// ResolveGitHubToken looks up a token for the GitHub host without it being
+// passed on the command line. It tries, in order, the environment variables the
+// gh CLI uses (GITHUB_TOKEN and GH_TOKEN for github.com, GH_ENTERPRISE_TOKEN
+// and GITHUB_ENTERPRISE_TOKEN for other hosts), the gh hosts file and git's
+// credential helpers. It returns the token and a description of where it was
+// found, or two empty strings.
+func ResolveGitHubToken(host string) (string, string) {
+	envVars := []string{"GITHUB_TOKEN", "GH_TOKEN"}
+	if host != DefaultGitHubHost {
+		envVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, envVar := range envVars {
+		if token := os.Getenv(envVar); token != "" {
+			return token, envVar
+		}
+	}
+
+	if token := ghHostsToken(host); token != "" {
+		return token, "gh hosts file"
+	}
+
+	if token := gitCredentialToken(host); token != "" {
+		return token, "git credential helper"
+	}
+
+	return "", ""
+}
+
+// ResolveGitLabToken looks up a token for the GitLab host in GITLAB_TOKEN, as
+// used by the glab CLI, and then in git's credential helpers. It returns the
+// token and a description of where it was found, or two empty strings.
+func ResolveGitLabToken(host string) (string, string) {
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		return token, "GITLAB_TOKEN"
+	}
+	if token := gitCredentialToken(host); token != "" {
+		return token, "git credential helper"
+	}
+	return "", ""
+}
+
+// ghHostsToken reads the oauth_token of host from the hosts.yml file of the gh
+// CLI. Tokens gh keeps in the system keyring are not visible there.
+func ghHostsToken(host string) string {
+	configDir := os.Getenv("GH_CONFIG_DIR")
+	if configDir == "" {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return ""
+			}
+			configHome = filepath.Join(home, ".config")
+		}
+		configDir = filepath.Join(configHome, "gh")
+	}
+
+	file, err := os.Open(filepath.Join(configDir, "hosts.yml"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// The file maps hosts to settings; only the oauth_token directly below the
+	// host is of interest, so the indentation is all the YAML that is parsed
+	inHost := false
+	childIndent := -1
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 {
+			inHost = unquoteYAML(strings.TrimSuffix(trimmed, ":")) == host
+			childIndent = -1
+			continue
+		}
+		if !inHost {
+			continue
+		}
+		if childIndent < 0 {
+			childIndent = indent
+		}
+		if indent == childIndent && strings.HasPrefix(trimmed, "oauth_token:") {
+			return unquoteYAML(strings.TrimSpace(strings.TrimPrefix(trimmed, "oauth_token:")))
+		}
+	}
+	return ""
+}
+
+func unquoteYAML(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// gitCredentialToken asks git's credential helpers for the password stored for
+// https://host. Prompting is disabled so that a missing credential never blocks.
+func gitCredentialToken(host string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		return ""
+	}
+
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	// An empty GIT_ASKPASS also keeps git from falling back to SSH_ASKPASS
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "GCM_INTERACTIVE=never")
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "password=") {
+			return strings.TrimPrefix(line, "password=")
+		}
+	}
+	return ""
+}
+
+// gitAuthEnv returns environment variables that make git authenticate to the
+// host of repoURL as user with token as the password. The token is passed as
+// configuration in the environment rather than in the URL or the arguments,
+// where it would show up in process listings and in the remote URL saved in
+// the clone.
+func gitAuthEnv(repoURL, user, token string) []string {
+	if token == "" {
+		return nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + u.Scheme + "://" + u.Host + "/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+		"GIT_TERMINAL_PROMPT=0",
+	}
+}
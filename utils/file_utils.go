@@ -1,18 +1,101 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
 	"github.com/sabhiram/go-gitignore"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
+	"unicode/utf8"
 )
 
-func DumpProject(rootPath string, gitIgnore *ignore.GitIgnore, includeGit, includeNonText bool) (ProjectData, error) {
+// EncodingBase64 marks a FileData whose Content holds base64-encoded bytes.
+const EncodingBase64 = "base64"
+
+// readFile reads the contents of a dumped file; tests replace it to count reads.
+var readFile = ioutil.ReadFile
+
+// DumpProject reads the project at rootPath into memory. Files are read by up
+// to jobs workers; the result is sorted and does not depend on jobs.
+func DumpProject(rootPath string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool, jobs int) (ProjectData, error) {
+	return dumpProject(rootPath, filepath.Walk, gitIgnore, includeGit, includeNonText, jobs)
+}
+
+// DumpProjectFiles is DumpProject for the given files, relative to rootPath,
+// instead of everything under rootPath. Listed files that do not exist are
+// skipped, and directories are taken from the parents of the listed files.
+func DumpProjectFiles(rootPath string, paths []string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool, jobs int) (ProjectData, error) {
+	return dumpProject(rootPath, walkFileList(paths), gitIgnore, includeGit, includeNonText, jobs)
+}
+
+func dumpProject(rootPath string, walk walkFunc, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool, jobs int) (ProjectData, error) {
+	projectData, err := walkProject(rootPath, walk, gitIgnore, includeGit)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	i := 0
+	err = readProjectFiles(rootPath, projectData.Files, includeNonText, jobs, func(file FileData) error {
+		projectData.Files[i] = file
+		i++
+		return nil
+	})
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	return projectData, nil
+}
+
+// walkFunc visits the entries of a project like filepath.Walk.
+type walkFunc func(root string, fn filepath.WalkFunc) error
+
+// walkFileList returns a walkFunc that visits the listed files, relative to the
+// root, and their parent directories instead of every entry under the root.
+func walkFileList(paths []string) walkFunc {
+	return func(root string, fn filepath.WalkFunc) error {
+		visited := make(map[string]bool)
+		for _, relPath := range paths {
+			path := filepath.Join(root, relPath)
+			info, err := os.Lstat(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			var dirs []string
+			for dir := filepath.Dir(relPath); dir != "." && !visited[dir]; dir = filepath.Dir(dir) {
+				visited[dir] = true
+				dirs = append(dirs, dir)
+			}
+			for i := len(dirs) - 1; i >= 0; i-- {
+				dirInfo, err := os.Lstat(filepath.Join(root, dirs[i]))
+				if err := fn(filepath.Join(root, dirs[i]), dirInfo, err); err != nil {
+					return err
+				}
+			}
+
+			if err := fn(path, info, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// walkProject records the structure of the project at rootPath without reading
+// file contents. Regular files that pass the path patterns are marked as
+// pending for readProjectFiles, which decides whether they are text.
+func walkProject(rootPath string, walk walkFunc, gitIgnore ignore.IgnoreParser, includeGit bool) (ProjectData, error) {
 	var projectData ProjectData
 
-	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+	err := walk(rootPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -27,17 +110,23 @@ func DumpProject(rootPath string, gitIgnore *ignore.GitIgnore, includeGit, inclu
 
 		if info.IsDir() {
 			projectData.Directories = append(projectData.Directories, relPath)
-		} else {
-			if MatchesPatterns(relPath, gitIgnore, includeGit, includeNonText) {
-				content, err := ioutil.ReadFile(path)
+			return nil
+		}
+
+		fileData := newFileData(relPath, info)
+		if info.Mode()&os.ModeSymlink != 0 {
+			// Symlinks are recorded as links rather than copies of their targets
+			if matchesPathPatterns(relPath, gitIgnore, includeGit) {
+				target, err := os.Readlink(path)
 				if err != nil {
 					return err
 				}
-				projectData.Files = append(projectData.Files, FileData{Path: relPath, Content: string(content)})
-			} else {
-				projectData.Files = append(projectData.Files, FileData{Path: relPath, Content: ""})
+				fileData.SymlinkTarget = target
 			}
+		} else if info.Size() > 0 && matchesPathPatterns(relPath, gitIgnore, includeGit) {
+			fileData.contentPending = true
 		}
+		projectData.Files = append(projectData.Files, fileData)
 		return nil
 	})
 
@@ -53,7 +142,147 @@ func DumpProject(rootPath string, gitIgnore *ignore.GitIgnore, includeGit, inclu
 	return projectData, nil
 }
 
-func ReconstructProject(projectData ProjectData, outputPath string) error {
+// readProjectFiles reads the contents of the pending files with up to jobs
+// concurrent workers and passes every file to emit in the order of files. At
+// most jobs files are held in memory at any time.
+func readProjectFiles(rootPath string, files []FileData, includeNonText bool, jobs int, emit func(FileData) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	type readResult struct {
+		file FileData
+		err  error
+	}
+	results := make([]chan readResult, len(files))
+	for i := range results {
+		results[i] = make(chan readResult, 1)
+	}
+
+	// A slot is taken when a file is dispatched and given back once emit has consumed it
+	slots := make(chan struct{}, jobs)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for i, file := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int, file FileData) {
+				file, err := readProjectFile(rootPath, file, includeNonText)
+				results[i] <- readResult{file: file, err: err}
+			}(i, file)
+		}
+	}()
+
+	for i := range files {
+		result := <-results[i]
+		<-slots
+		if result.err != nil {
+			return result.err
+		}
+		if err := emit(result.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readProjectFile reads a pending file once and decides from the bytes read
+// whether it is text.
+func readProjectFile(rootPath string, file FileData, includeNonText bool) (FileData, error) {
+	if !file.contentPending {
+		return file, nil
+	}
+	file.contentPending = false
+
+	content, err := readFile(filepath.Join(rootPath, file.Path))
+	if err != nil {
+		return file, err
+	}
+	file.setFileContent(content, includeNonText)
+	return file, nil
+}
+
+// setFileContent stores content if it is text or includeNonText is set, and
+// otherwise marks the file as non-text so that it is left out of the output.
+func (f *FileData) setFileContent(content []byte, includeNonText bool) {
+	f.textChecked = true
+	f.nonText = !isTextData(f.Path, content)
+	if includeNonText || !f.nonText {
+		f.SetContent(content)
+	}
+}
+
+// isNonText reports whether the file is not text. Files loaded from JSON or
+// Markdown were not checked when read, so their decoded content is checked.
+func (f FileData) isNonText() bool {
+	if f.textChecked {
+		return f.nonText
+	}
+	if f.Content == "" {
+		return false
+	}
+	content, err := f.DecodedContent()
+	return err != nil || !isTextData(f.Path, content)
+}
+
+// newFileData creates a FileData carrying the permission bits and modification time of info.
+func newFileData(path string, info os.FileInfo) FileData {
+	modTime := info.ModTime()
+	fileData := FileData{Path: path, ModTime: &modTime}
+	if info.Mode().IsRegular() {
+		fileData.Mode = info.Mode().Perm()
+	}
+	return fileData
+}
+
+// SetContent stores content in the FileData, base64-encoding it when it would
+// not survive a round-trip through a JSON string (invalid UTF-8 or NUL bytes).
+func (f *FileData) SetContent(content []byte) {
+	if utf8.Valid(content) && bytes.IndexByte(content, 0) < 0 {
+		f.Content = string(content)
+		f.Encoding = ""
+		return
+	}
+	f.Content = base64.StdEncoding.EncodeToString(content)
+	f.Encoding = EncodingBase64
+}
+
+// DecodedContent returns the original bytes of the file, undoing any encoding.
+func (f FileData) DecodedContent() ([]byte, error) {
+	switch f.Encoding {
+	case "":
+		return []byte(f.Content), nil
+	case EncodingBase64:
+		return base64.StdEncoding.DecodeString(f.Content)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", f.Encoding)
+	}
+}
+
+// ReconstructProject writes projectData below outputPath. Unless allowUnsafePaths
+// is set, the project is validated with ValidateProjectPaths first and nothing is
+// written if any entry would end up outside outputPath. Existing files and
+// symlinks at the path of a file are replaced rather than written through.
+// A part of a split dump holding a segment of a file is refused, as writing it
+// would leave the file truncated.
+func ReconstructProject(projectData ProjectData, outputPath string, allowUnsafePaths bool) error {
+	for _, file := range projectData.Files {
+		if file.Segment != nil {
+			return fmt.Errorf("file %s is segment %d of %d of a split dump; merge the parts first", file.Path, file.Segment.Part, file.Segment.Total)
+		}
+	}
+
+	if !allowUnsafePaths {
+		if err := ValidateProjectPaths(projectData, outputPath); err != nil {
+			return err
+		}
+	}
+
 	// First, create all directories
 	for _, dir := range projectData.Directories {
 		fullPath := filepath.Join(outputPath, dir)
@@ -73,11 +302,80 @@ func ReconstructProject(projectData ProjectData, outputPath string) error {
 			return fmt.Errorf("error creating directory for file %s: %v", filePath, err)
 		}
 
-		err = ioutil.WriteFile(filePath, []byte(file.Content), 0644)
+		if file.SymlinkTarget != "" {
+			err = writeSymlink(file.SymlinkTarget, filePath)
+			if err != nil {
+				return fmt.Errorf("error creating symlink %s: %v", file.Path, err)
+			}
+			continue
+		}
+
+		content, err := file.DecodedContent()
+		if err != nil {
+			return fmt.Errorf("error decoding file %s: %v", file.Path, err)
+		}
+
+		mode := os.FileMode(0644)
+		if file.Mode != 0 {
+			mode = file.Mode.Perm()
+		}
+
+		err = writeNewFile(filePath, content, mode)
 		if err != nil {
 			return fmt.Errorf("error writing file %s: %v", file.Path, err)
 		}
+
+		// Creating the file applies the umask
+		err = os.Chmod(filePath, mode)
+		if err != nil {
+			return fmt.Errorf("error setting mode of file %s: %v", file.Path, err)
+		}
+
+		if file.ModTime != nil {
+			err = os.Chtimes(filePath, *file.ModTime, *file.ModTime)
+			if err != nil {
+				return fmt.Errorf("error setting modification time of file %s: %v", file.Path, err)
+			}
+		}
 	}
 
 	return nil
 }
+
+// writeNewFile replaces whatever is at path, such as a leftover symlink that
+// would otherwise redirect the write, with a new file. O_EXCL makes the create
+// fail rather than follow a symlink that appears in the meantime.
+func writeNewFile(path string, content []byte, mode os.FileMode) error {
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeSymlink(target, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, path)
+}
+
+// setModTimes overrides the modification time of every file in projectData.
+func setModTimes(projectData *ProjectData, modTime time.Time) {
+	for i := range projectData.Files {
+		t := modTime
+		projectData.Files[i].ModTime = &t
+	}
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconstructPreservesMetadata(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "onefile-src-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	scriptPath := filepath.Join(srcDir, "build.sh")
+	if err := ioutil.WriteFile(scriptPath, []byte("#!/bin/sh\necho build\n"), 0755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(scriptPath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if err := os.Symlink("build.sh", filepath.Join(srcDir, "make.sh")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	projectData, err := DumpProject(srcDir, CreateGitIgnoreMatcher(nil), false, false, 2)
+	if err != nil {
+		t.Fatalf("DumpProject failed: %v", err)
+	}
+
+	dstDir, err := ioutil.TempDir("", "onefile-dst-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	if err := ReconstructProject(projectData, dstDir, false); err != nil {
+		t.Fatalf("ReconstructProject failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dstDir, "build.sh"))
+	if err != nil {
+		t.Fatalf("Reconstructed script missing: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("build.sh mode = %v; want %v", info.Mode().Perm(), os.FileMode(0755))
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("build.sh mod time = %v; want %v", info.ModTime(), modTime)
+	}
+
+	target, err := os.Readlink(filepath.Join(dstDir, "make.sh"))
+	if err != nil {
+		t.Fatalf("make.sh is not a symlink: %v", err)
+	}
+	if target != "build.sh" {
+		t.Errorf("make.sh target = %q; want %q", target, "build.sh")
+	}
+}
+
+func TestBinaryContentRoundTrip(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\n'}
+
+	var fileData FileData
+	fileData.SetContent(binary)
+	if fileData.Encoding != EncodingBase64 {
+		t.Fatalf("Encoding = %q; want %q", fileData.Encoding, EncodingBase64)
+	}
+
+	data, err := json.Marshal(fileData)
+	if err != nil {
+		t.Fatalf("Failed to marshal file data: %v", err)
+	}
+	var decoded FileData
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal file data: %v", err)
+	}
+
+	content, err := decoded.DecodedContent()
+	if err != nil {
+		t.Fatalf("DecodedContent failed: %v", err)
+	}
+	if !bytes.Equal(content, binary) {
+		t.Errorf("DecodedContent() = %v; want %v", content, binary)
+	}
+
+	fileData.SetContent([]byte("plain text\n"))
+	if fileData.Encoding != "" || fileData.Content != "plain text\n" {
+		t.Errorf("Text content was encoded: %+v", fileData)
+	}
+}
+
+func TestReconstructReplacesSymlinkAtTarget(t *testing.T) {
+	outsideDir, err := ioutil.TempDir("", "onefile-outside-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outsideDir)
+	outsideFile := filepath.Join(outsideDir, "secret")
+	if err := ioutil.WriteFile(outsideFile, []byte("keep\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	dstDir, err := ioutil.TempDir("", "onefile-dst-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+	if err := os.Symlink(outsideFile, filepath.Join(dstDir, "config")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	projectData := ProjectData{Files: []FileData{{Path: "config", Content: "replaced\n"}}}
+	if err := ReconstructProject(projectData, dstDir, false); err != nil {
+		t.Fatalf("ReconstructProject failed: %v", err)
+	}
+
+	if content, err := ioutil.ReadFile(outsideFile); err != nil || string(content) != "keep\n" {
+		t.Errorf("File outside the output directory was written: %q, %v", content, err)
+	}
+	info, err := os.Lstat(filepath.Join(dstDir, "config"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("config was not replaced by a regular file: %v, %v", info, err)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dstDir, "config")); string(content) != "replaced\n" {
+		t.Errorf("config = %q", content)
+	}
+}
+
+func TestDumpReadsFilesOnce(t *testing.T) {
+	rootPath := writeTestProject(t)
+	defer os.RemoveAll(rootPath)
+
+	reads := make(map[string]int)
+	var mu sync.Mutex
+	readFile = func(path string) ([]byte, error) {
+		mu.Lock()
+		reads[path]++
+		mu.Unlock()
+		return ioutil.ReadFile(path)
+	}
+	defer func() { readFile = ioutil.ReadFile }()
+
+	if _, err := DumpProject(rootPath, CreateGitIgnoreMatcher(nil), false, false, 4); err != nil {
+		t.Fatalf("DumpProject failed: %v", err)
+	}
+	var streamed bytes.Buffer
+	if err := StreamProject(rootPath, CreateGitIgnoreMatcher(nil), false, false, 4, NewMarkdownWriter(&streamed, false, false, false)); err != nil {
+		t.Fatalf("StreamProject failed: %v", err)
+	}
+
+	for _, name := range []string{"main.go", "src/LICENSE", "src/Makefile", "assets/logo", "docs/guide.md"} {
+		if n := reads[filepath.Join(rootPath, name)]; n != 2 {
+			t.Errorf("%s was read %d times by two dumps, want once per dump", name, n)
+		}
+	}
+}
@@ -0,0 +1,575 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabhiram/go-gitignore"
+)
+
+// errSparseIndex is returned by readGitIndex for sparse indexes, whose
+// directory entries can only be expanded by reading tree objects.
+var errSparseIndex = errors.New("sparse index")
+
+// errSplitIndex is returned by readGitIndex for split indexes, which only hold
+// the changes to a shared index file.
+var errSplitIndex = errors.New("split index")
+
+// GitTrackedFiles lists the files in the index of the git repository that
+// contains rootPath, staged but uncommitted files included, relative to
+// rootPath. With includeUntracked, files that are neither tracked nor ignored
+// are listed too. The index is read directly, so the git binary is only needed
+// for index formats onefile does not understand.
+func GitTrackedFiles(rootPath string, includeUntracked bool) ([]string, error) {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	repoRoot := findRepoRoot(absRoot)
+	if repoRoot == "" {
+		return nil, fmt.Errorf("%s is not inside a git repository", rootPath)
+	}
+	prefix, err := filepath.Rel(repoRoot, absRoot)
+	if err != nil {
+		return nil, err
+	}
+	prefix = filepath.ToSlash(prefix)
+
+	dir := gitDir(repoRoot)
+	var tracked []string
+	// Index entries are only parsed for SHA-1 repositories
+	if format := gitObjectFormat(dir); format != "sha1" {
+		err = fmt.Errorf("unsupported object format %s", format)
+	} else {
+		tracked, err = readGitIndex(filepath.Join(dir, "index"))
+	}
+	if err != nil {
+		if _, lookErr := exec.LookPath("git"); lookErr != nil {
+			return nil, fmt.Errorf("failed to read git index: %v", err)
+		}
+		if tracked, err = gitLsFiles(repoRoot); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, repoPath := range tracked {
+		relPath := repoPath
+		if prefix != "." {
+			if !strings.HasPrefix(repoPath, prefix+"/") {
+				continue
+			}
+			relPath = repoPath[len(prefix)+1:]
+		}
+		if !seen[relPath] {
+			seen[relPath] = true
+			paths = append(paths, filepath.FromSlash(relPath))
+		}
+	}
+
+	if includeUntracked {
+		untracked, err := untrackedFiles(absRoot, seen)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, untracked...)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// gitObjectFormat returns the hash algorithm of the repository whose git
+// directory is dir, from extensions.objectFormat in its configuration.
+// Worktrees share the configuration of the main repository.
+func gitObjectFormat(dir string) string {
+	if common, err := ioutil.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(dir, commonDir)
+		}
+		dir = commonDir
+	}
+	if format := readGitConfigValue(filepath.Join(dir, "config"), "extensions", "objectformat"); format != "" {
+		return strings.ToLower(format)
+	}
+	return "sha1"
+}
+
+// readGitIndex returns the paths of the files recorded in a git index file
+// (versions 2 to 4) of a SHA-1 repository. Submodules are left out. A missing
+// index, as in a new repository, has no entries. Sparse and split indexes
+// are not complete on their own and yield errSparseIndex and errSplitIndex.
+func readGitIndex(indexPath string) ([]string, error) {
+	data, err := ioutil.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, fmt.Errorf("%s is not a git index", indexPath)
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	const (
+		entryHeaderSize = 62
+		extendedFlag    = 0x4000
+		modeTypeMask    = 0170000
+		modeGitlink     = 0160000
+		modeDirectory   = 0040000
+	)
+
+	var paths []string
+	var previousName string
+	offset := 12
+	for i := uint32(0); i < count; i++ {
+		start := offset
+		if offset+entryHeaderSize > len(data) {
+			return nil, fmt.Errorf("truncated git index")
+		}
+		mode := binary.BigEndian.Uint32(data[offset+24 : offset+28])
+		flags := binary.BigEndian.Uint16(data[offset+60 : offset+62])
+		offset += entryHeaderSize
+		if version >= 3 && flags&extendedFlag != 0 {
+			offset += 2
+		}
+
+		var name string
+		if version == 4 {
+			// Names are stored as the number of bytes to drop from the end of the
+			// previous name followed by the NUL-terminated suffix to append
+			strip, n := readIndexVarint(data[offset:])
+			if n == 0 || strip > len(previousName) {
+				return nil, fmt.Errorf("invalid path in git index")
+			}
+			offset += n
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("truncated git index")
+			}
+			name = previousName[:len(previousName)-strip] + string(data[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("truncated git index")
+			}
+			name = string(data[offset : offset+end])
+			// Entries are padded with NULs to a multiple of eight bytes
+			offset = start + (offset+end-start+8)/8*8
+		}
+		previousName = name
+
+		switch mode & modeTypeMask {
+		case modeGitlink:
+			continue
+		case modeDirectory:
+			return nil, errSparseIndex
+		}
+		// Files with merge conflicts have one entry per stage
+		if len(paths) > 0 && paths[len(paths)-1] == name {
+			continue
+		}
+		paths = append(paths, name)
+	}
+
+	// Extensions follow the entries, each a signature and a size, up to the
+	// trailing checksum
+	const checksumSize = 20
+	for offset+8 <= len(data)-checksumSize {
+		signature := string(data[offset : offset+4])
+		size := int(binary.BigEndian.Uint32(data[offset+4 : offset+8]))
+		if signature == "link" {
+			return nil, errSplitIndex
+		}
+		offset += 8 + size
+	}
+
+	return paths, nil
+}
+
+// readIndexVarint decodes the offset encoding used by git for the path
+// prefixes of version 4 indexes and returns the value and its length.
+func readIndexVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	value := int(data[0] & 0x7f)
+	n := 1
+	for data[n-1]&0x80 != 0 {
+		if n == len(data) {
+			return 0, 0
+		}
+		value = (value+1)<<7 | int(data[n]&0x7f)
+		n++
+	}
+	return value, n
+}
+
+// gitLsFiles lists the tracked files of the repository at repoRoot with git.
+func gitLsFiles(repoRoot string) ([]string, error) {
+	cmd := exec.Command("git", "ls-files", "-z", "--cached")
+	cmd.Dir = repoRoot
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %v", err)
+	}
+	return splitNulTerminated(output), nil
+}
+
+func splitNulTerminated(output []byte) []string {
+	trimmed := strings.TrimSuffix(string(output), "\x00")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "\x00")
+}
+
+// untrackedFiles walks rootPath for files that are not in tracked and not
+// ignored by git. Like git, it does not descend into nested repositories.
+func untrackedFiles(rootPath string, tracked map[string]bool) ([]string, error) {
+	repoIgnore, err := NewRepoIgnore(rootPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" || repoIgnore.MatchesPath(relPath+"/") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !tracked[filepath.ToSlash(relPath)] && !repoIgnore.MatchesPath(relPath) {
+			paths = append(paths, relPath)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// gitDiffArgs returns the arguments of git diff that select the changes of
+// GitChangedFiles: since alone compares the merge base of since and HEAD with
+// the working tree, staged compares HEAD (or that merge base) with the index,
+// worktree compares the index with the working tree, and staged together with
+// worktree compares HEAD with the working tree.
+func gitDiffArgs(rootPath, since string, staged, worktree bool) ([]string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--relative"}
+	if staged && !worktree {
+		args = append(args, "--cached")
+	}
+	if since != "" {
+		cmd := exec.Command("git", "merge-base", since, "HEAD")
+		cmd.Dir = rootPath
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the merge base of %s and HEAD: %v", since, err)
+		}
+		args = append(args, strings.TrimSpace(string(output)))
+	} else if staged && worktree {
+		args = append(args, "HEAD")
+	} else if !staged && !worktree {
+		return nil, fmt.Errorf("no changes selected")
+	}
+	return args, nil
+}
+
+// GitChangedFiles lists the files under rootPath that were added or modified
+// in the changes selected by since, staged and worktree (see dump --since),
+// relative to rootPath. Deleted files have no content to dump and are left
+// out. It requires the git binary.
+func GitChangedFiles(rootPath, since string, staged, worktree bool) ([]string, error) {
+	args, err := gitDiffArgs(rootPath, since, staged, worktree)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", append(args, "--name-only", "-z", "--diff-filter=d")...)
+	cmd.Dir = rootPath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %v", err)
+	}
+
+	var paths []string
+	for _, path := range splitNulTerminated(output) {
+		paths = append(paths, filepath.FromSlash(path))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// GitDiffs returns the unified diff of each of paths, relative to rootPath, in
+// the changes selected as for GitChangedFiles.
+func GitDiffs(rootPath string, paths []string, since string, staged, worktree bool) (map[string]string, error) {
+	args, err := gitDiffArgs(rootPath, since, staged, worktree)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make(map[string]string)
+	for _, path := range paths {
+		cmd := exec.Command("git", append(args, "--", ":(literal)"+filepath.ToSlash(path))...)
+		cmd.Dir = rootPath
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git diff failed for %s: %v", path, err)
+		}
+		if len(output) > 0 {
+			diffs[path] = string(output)
+		}
+	}
+	return diffs, nil
+}
+
+// FetchGitRepo dumps the repository at repoURL, which can be any URL or path
+// git clones from (https, ssh, scp-like user@host:path or file). The clone is
+// shallow where the remote allows it; with path set, only that directory is
+// checked out and dumped, with a partial clone if the remote supports it. ref
+// is a branch, tag or commit SHA, or empty for the default branch. The source
+// without credentials, the ref and the commit SHA are recorded in the result.
+func FetchGitRepo(repoURL, ref, path string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	location := RepoRef{Ref: ref, Path: strings.Trim(filepath.ToSlash(path), "/")}
+	projectData, err := fetchWithGit(repoURL, &location, nil, gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	projectData.Source = redactURL(repoURL)
+	return projectData, nil
+}
+
+// redactURL removes the password from a URL so that it is not recorded.
+func redactURL(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.User == nil {
+		return repoURL
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
+
+// fetchWithGit clones the ref and directory given by location from repoURL,
+// with env added to git's environment, and dumps it. The source is left to the
+// caller.
+func fetchWithGit(repoURL string, location *RepoRef, env []string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	tmpDir, err := ioutil.TempDir("", "onefile-clone-")
+	if err != nil {
+		return ProjectData{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if location.treePath != "" {
+		refs, err := gitRemoteRefs(repoURL, env)
+		if err != nil {
+			return ProjectData{}, err
+		}
+		err = location.resolveTreePath(func(ref string) (bool, error) {
+			return refs[ref] || isCommitSHA(ref), nil
+		})
+		if err != nil {
+			return ProjectData{}, err
+		}
+	}
+
+	commit, err := cloneRef(repoURL, location.Ref, location.Path, tmpDir, env)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	projectPath := filepath.Join(tmpDir, location.Path)
+	if _, err := os.Stat(projectPath); os.IsNotExist(err) {
+		return ProjectData{}, fmt.Errorf("path %q not found in the repository", location.Path)
+	}
+	projectData, err := DumpProject(projectPath, gitIgnore, includeGit, includeNonText, runtime.NumCPU())
+	if err != nil {
+		return ProjectData{}, err
+	}
+	projectData.Ref = location.Ref
+	projectData.Commit = commit
+
+	// Checkout times are meaningless, so files take the time of the cloned commit
+	output, err := exec.Command("git", "-C", tmpDir, "log", "-1", "--format=%cI").Output()
+	if err == nil {
+		if commitTime, err := time.Parse(time.RFC3339, strings.TrimSpace(string(output))); err == nil {
+			setModTimes(&projectData, commitTime)
+		}
+	}
+
+	return projectData, nil
+}
+
+// isCommitSHA reports whether ref looks like an abbreviated or full commit SHA.
+func isCommitSHA(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// gitRemoteRefs returns the branch and tag names of the repository at repoURL.
+// env is added to git's environment, e.g. for authentication.
+func gitRemoteRefs(repoURL string, env []string) (map[string]bool, error) {
+	cmd := exec.Command("git", "ls-remote", "--heads", "--tags", "--", repoURL)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-remote failed: %v", err)
+	}
+
+	refs := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], "^{}")
+		name = strings.TrimPrefix(name, "refs/heads/")
+		name = strings.TrimPrefix(name, "refs/tags/")
+		refs[name] = true
+	}
+	return refs, nil
+}
+
+// cloneRef makes a shallow clone of ref (a branch, tag or commit SHA, or the
+// default branch if empty) of the repository at repoURL into dir and returns
+// the SHA of the checked out commit. Commits that cannot be fetched on their
+// own, such as abbreviated SHAs, fall back to a full clone. If sparsePath is
+// set, the clone is partial: only the files in that directory and at the top
+// level are checked out and downloaded. env is added to git's environment,
+// e.g. for authentication. Refs starting with "-" are refused, as git would
+// take them for options.
+func cloneRef(repoURL, ref, sparsePath, dir string, env []string) (string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid ref %q", ref)
+	}
+
+	git := func(args ...string) error {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	// Blobs outside the sparse checkout are left on the server; servers
+	// that do not support filters send everything instead
+	var filter, sparse []string
+	sparseCheckout := func() error { return nil }
+	if sparsePath != "" {
+		filter = []string{"--filter=blob:none"}
+		sparse = append(filter, "--sparse")
+		sparseCheckout = func() error {
+			return git("sparse-checkout", "set", "--", sparsePath)
+		}
+	}
+	clone := func(args ...string) error {
+		args = append(append([]string{"clone", "-q"}, args...), "--", repoURL, ".")
+		return git(args...)
+	}
+
+	var err error
+	switch {
+	case ref == "":
+		err = clone(append([]string{"--depth", "1"}, sparse...)...)
+		if err == nil {
+			err = sparseCheckout()
+		}
+	case isCommitSHA(ref) && len(ref) == 40:
+		err = git("init", "-q")
+		if err == nil {
+			err = sparseCheckout()
+		}
+		if err == nil {
+			err = git(append(append([]string{"fetch", "-q", "--depth", "1"}, filter...), "--", repoURL, ref)...)
+		}
+		if err == nil {
+			err = git("checkout", "-q", "FETCH_HEAD")
+		}
+	default:
+		err = clone(append([]string{"--depth", "1", "--branch", ref}, sparse...)...)
+		if err == nil {
+			err = sparseCheckout()
+		}
+	}
+
+	if err != nil && ref != "" {
+		if err := resetDir(dir); err != nil {
+			return "", err
+		}
+		err = clone(append([]string{"--no-checkout"}, filter...)...)
+		if err == nil {
+			err = sparseCheckout()
+		}
+		if err == nil {
+			err = git("checkout", "-q", ref, "--")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse failed: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// resetDir removes everything inside dir.
+func resetDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,217 +2,665 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"net/url"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/sabhiram/go-gitignore"
 	"github.com/schollz/progressbar/v3"
 )
 
-func FetchGithubRepo(owner, repo, path string, gitIgnore *ignore.GitIgnore, useGit bool, githubToken string, includeGit, includeNonText bool) (ProjectData, error) {
-	if useGit {
-		return fetchWithGit(owner, repo, path, gitIgnore, includeGit, includeNonText)
+// githubAPIURL is the base URL of the REST API of github.com.
+var githubAPIURL = "https://api.github.com"
+
+// GitHubAPIURL returns the base URL of the REST API for a GitHub host:
+// api.github.com for github.com and /api/v3 on GitHub Enterprise Server.
+func GitHubAPIURL(host string) string {
+	if host == DefaultGitHubHost || host == "" {
+		return githubAPIURL
 	}
-	return fetchWithAPI(owner, repo, path, gitIgnore, githubToken, includeGit, includeNonText)
+	return "https://" + host + "/api/v3"
 }
 
-func fetchWithGit(owner, repo, path string, gitIgnore *ignore.GitIgnore, includeGit, includeNonText bool) (ProjectData, error) {
-	tmpDir, err := ioutil.TempDir("", "github-clone-")
+// Strategies for fetching a GitHub repository.
+const (
+	// FetchMethodAuto uses git if it is installed and the tarball otherwise
+	FetchMethodAuto = "auto"
+	// FetchMethodGit makes a shallow clone with the git binary
+	FetchMethodGit = "git"
+	// FetchMethodTarball downloads the repository as a single tarball
+	FetchMethodTarball = "tarball"
+	// FetchMethodAPI walks the contents API, one request per directory and file
+	FetchMethodAPI = "api"
+)
+
+// FetchGithubRepo fetches the repository, ref and directory given by location
+// with one of the FetchMethod strategies. The source, ref and resolved commit
+// SHA are recorded in the result, and the ref and path of location are updated
+// once a /tree/ URL has been resolved. API requests go to apiURL, or to the
+// API of the location's host if it is empty; they are retried on transient
+// errors and wait for short rate limits, and verbose reports the remaining quota.
+// The api method sends up to concurrency requests at a time.
+func FetchGithubRepo(location *GitHubLocation, gitIgnore ignore.IgnoreParser, method, apiURL, githubToken string, concurrency int, includeGit, includeNonText, verbose bool) (ProjectData, error) {
+	method = resolveFetchMethod(method)
+	if apiURL == "" {
+		apiURL = GitHubAPIURL(location.Host)
+	}
+	client := newGitHubClient(apiURL, githubToken, verbose)
+	var projectData ProjectData
+	var err error
+	switch method {
+	case FetchMethodGit:
+		repoURL := location.RepoURL() + ".git"
+		projectData, err = fetchWithGit(repoURL, &location.RepoRef, gitAuthEnv(repoURL, "x-access-token", githubToken), gitIgnore, includeGit, includeNonText)
+	case FetchMethodTarball:
+		projectData, err = fetchWithTarball(location, gitIgnore, client, includeGit, includeNonText)
+	case FetchMethodAPI:
+		projectData, err = fetchWithAPI(location, gitIgnore, client, concurrency, includeGit, includeNonText)
+	default:
+		return ProjectData{}, fmt.Errorf("unknown fetch method %q, use auto, git, tarball or api", method)
+	}
 	if err != nil {
 		return ProjectData{}, err
 	}
-	defer os.RemoveAll(tmpDir)
+	projectData.Source = location.RepoURL()
+	return projectData, nil
+}
+
+// resolveFetchMethod turns FetchMethodAuto into git if it is installed and
+// into the tarball otherwise.
+func resolveFetchMethod(method string) string {
+	if method != FetchMethodAuto && method != "" {
+		return method
+	}
+	if _, err := exec.LookPath("git"); err == nil {
+		return FetchMethodGit
+	}
+	return FetchMethodTarball
+}
 
-	repoURL := fmt.Sprintf("https://github.com/%s/%s.git", owner, repo)
-	cmd := exec.Command("git", "clone", "--depth", "1", repoURL, tmpDir)
-	err = cmd.Run()
+// fetchWithTarball downloads the resolved commit as one tarball and extracts
+// it while it is being downloaded.
+func fetchWithTarball(location *GitHubLocation, gitIgnore ignore.IgnoreParser, client *apiClient, includeGit, includeNonText bool) (ProjectData, error) {
+	commit, err := resolveCommit(location, client)
 	if err != nil {
-		return ProjectData{}, fmt.Errorf("git clone failed: %v", err)
+		return ProjectData{}, err
+	}
+
+	// Entries are named <owner>-<repo>-<short sha>/<path>
+	projectData, err := downloadTarball(fmt.Sprintf("%s/repos/%s/%s/tarball/%s", client.baseURL, location.Owner, location.Repo, commit), location.Path, client, gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
 	}
+	projectData.Ref = location.Ref
+	projectData.Commit = commit
 
-	projectPath := filepath.Join(tmpDir, path)
-	return DumpProject(projectPath, gitIgnore, includeGit, includeNonText)
+	return projectData, nil
 }
 
-func fetchWithAPI(owner, repo, path string, gitIgnore *ignore.GitIgnore, githubToken string, includeGit, includeNonText bool) (ProjectData, error) {
-	var projectData ProjectData
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s", owner, repo, path)
+// downloadTarball extracts the subdir of the .tar.gz archive at url while it is
+// being downloaded. The archive must hold a single top-level directory.
+func downloadTarball(url, subdir string, client *apiClient, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	resp, err := client.get(url)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	defer resp.Body.Close()
 
-	bar := progressbar.Default(-1, "Fetching repository")
+	if resp.StatusCode != http.StatusOK {
+		return ProjectData{}, client.statusError(resp)
+	}
 
-	client := &http.Client{}
-	err := fetchContents(apiURL, path, &projectData, gitIgnore, bar, client, githubToken, includeGit, includeNonText)
+	bar := progressbar.DefaultBytes(resp.ContentLength, "Downloading tarball")
+	projectData, err := extractTarGz(io.TeeReader(resp.Body, bar), 1, subdir, gitIgnore, includeGit, includeNonText)
 	if err != nil {
 		return ProjectData{}, err
 	}
-
 	bar.Finish()
 
 	sort.Strings(projectData.Directories)
 	sort.Slice(projectData.Files, func(i, j int) bool {
 		return projectData.Files[i].Path < projectData.Files[j].Path
 	})
-
 	return projectData, nil
 }
 
-func fetchContents(url, path string, projectData *ProjectData, gitIgnore *ignore.GitIgnore, bar *progressbar.ProgressBar, client *http.Client, githubToken string, includeGit, includeNonText bool) error {
-	req, err := http.NewRequest("GET", url, nil)
+// fetchWithAPI walks the contents API with up to concurrency requests in
+// flight: the directory listings first, so that the number of files is known,
+// then the downloads of the files that pass the patterns.
+func fetchWithAPI(location *GitHubLocation, gitIgnore ignore.IgnoreParser, client *apiClient, concurrency int, includeGit, includeNonText bool) (ProjectData, error) {
+	commit, err := resolveCommit(location, client)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	// Fetching by commit keeps the result consistent if the ref moves meanwhile
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", client.baseURL, location.Owner, location.Repo, location.Path, url.QueryEscape(commit))
+
+	lister := newContentsLister(client, location.Path, includeGit, concurrency)
+	lister.list(apiURL)
+	directories, contents, err := lister.wait()
 	if err != nil {
-		return err
+		return ProjectData{}, err
+	}
+
+	var projectData ProjectData
+	projectData.Directories = directories
+	projectData.Files = make([]FileData, len(contents))
+	urls := make([]string, len(contents))
+	for i, content := range contents {
+		projectData.Files[i] = FileData{Path: content.Path}
+		if matchesPathPatterns(content.Path, gitIgnore, includeGit) {
+			urls[i] = content.DownloadURL
+		}
+	}
+
+	err = downloadFiles(projectData.Files, urls, client, concurrency, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	sort.Strings(projectData.Directories)
+	sort.Slice(projectData.Files, func(i, j int) bool {
+		return projectData.Files[i].Path < projectData.Files[j].Path
+	})
+	projectData.Ref = location.Ref
+	projectData.Commit = commit
+
+	return projectData, nil
+}
+
+// resolveCommit resolves the ref of location, splitting a /tree/ URL into a
+// ref and a path first, to a commit SHA with the GitHub API.
+func resolveCommit(location *GitHubLocation, client *apiClient) (string, error) {
+	if location.treePath != "" {
+		err := location.resolveTreePath(func(ref string) (bool, error) {
+			_, err := fetchCommitSHA(location.Owner, location.Repo, ref, client)
+			if err == errRefNotFound {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err != nil {
+			return "", err
+		}
 	}
 
-	if githubToken != "" {
-		req.Header.Set("Authorization", "token "+githubToken)
+	commit, err := fetchCommitSHA(location.Owner, location.Repo, location.Ref, client)
+	if err == errRefNotFound {
+		return "", fmt.Errorf("ref %q not found in %s/%s", location.Ref, location.Owner, location.Repo)
 	}
+	return commit, err
+}
 
-	resp, err := client.Do(req)
+// errRefNotFound is returned by fetchCommitSHA for refs the repository does not have.
+var errRefNotFound = errors.New("ref not found")
+
+// fetchCommitSHA resolves ref, or the default branch if ref is empty, to a
+// commit SHA with the GitHub API.
+func fetchCommitSHA(owner, repo, ref string, client *apiClient) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	resp, err := client.get(fmt.Sprintf("%s/repos/%s/%s/commits/%s", client.baseURL, owner, repo, escapeRef(ref)), "Accept", "application/vnd.github.sha")
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity {
+		return "", errRefNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("GitHub API returned status code %d", resp.StatusCode)
+		return "", client.statusError(resp)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return strings.TrimSpace(string(body)), nil
+}
 
-	var contents []GithubContent
-	err = json.Unmarshal(body, &contents)
-	if err != nil {
-		var singleFile GithubContent
-		err = json.Unmarshal(body, &singleFile)
-		if err != nil {
-			return err
-		}
-		contents = []GithubContent{singleFile}
+// escapeRef escapes each segment of a ref for use in a URL path.
+func escapeRef(ref string) string {
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// contentsLister lists a directory of the contents API and everything below
+// it, with one goroutine per directory and at most as many requests in flight
+// as it has slots. Paths are made relative to the listed directory.
+type contentsLister struct {
+	client     *apiClient
+	root       string
+	includeGit bool
+	slots      chan struct{}
+	wg         sync.WaitGroup
+
+	mu          sync.Mutex
+	directories []string
+	files       []GithubContent
+	err         error
+}
+
+func newContentsLister(client *apiClient, root string, includeGit bool, concurrency int) *contentsLister {
+	if concurrency < 1 {
+		concurrency = 1
 	}
+	return &contentsLister{
+		client:     client,
+		root:       strings.Trim(root, "/"),
+		includeGit: includeGit,
+		slots:      make(chan struct{}, concurrency),
+	}
+}
+
+// list starts listing the directory at url in the background.
+func (l *contentsLister) list(url string) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		l.slots <- struct{}{}
+		l.mu.Lock()
+		failed := l.err != nil
+		l.mu.Unlock()
+		if failed {
+			<-l.slots
+			return
+		}
+		contents, err := fetchContents(url, l.client)
+		<-l.slots
 
-	for _, content := range contents {
-		if !includeGit && (strings.HasPrefix(content.Path, ".git/") || content.Path == ".git") {
-			continue
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.err != nil {
+			return
+		}
+		if err != nil {
+			l.err = err
+			return
 		}
 
-		if content.Type == "dir" {
-			projectData.Directories = append(projectData.Directories, content.Path)
-			err = fetchContents(content.URL, content.Path, projectData, gitIgnore, bar, client, githubToken, includeGit, includeNonText)
-			if err != nil {
-				return err
+		for _, content := range contents {
+			content.Path = l.relPath(content.Path)
+			if !l.includeGit && (strings.HasPrefix(content.Path, ".git/") || content.Path == ".git") {
+				continue
 			}
-		} else if content.Type == "file" {
-			if MatchesPatterns(content.Path, gitIgnore, includeGit, includeNonText) {
-				fileContent, err := fetchFileContent(content.DownloadURL, client, githubToken)
-				if err != nil {
-					return err
-				}
-				projectData.Files = append(projectData.Files, FileData{Path: content.Path, Content: fileContent})
-			} else {
-				projectData.Files = append(projectData.Files, FileData{Path: content.Path, Content: ""})
+
+			switch content.Type {
+			case "dir":
+				l.directories = append(l.directories, content.Path)
+				l.list(content.URL)
+			case "file":
+				l.files = append(l.files, content)
 			}
-			bar.Describe(fmt.Sprintf("Downloaded: %s", filepath.Base(content.Path)))
-			bar.Add(1)
-			fmt.Printf("Processed: %s\n", filepath.Base(content.Path))
 		}
-	}
+	}()
+}
 
-	return nil
+// wait returns the directories and files once every listing has finished.
+func (l *contentsLister) wait() ([]string, []GithubContent, error) {
+	l.wg.Wait()
+	return l.directories, l.files, l.err
 }
 
-func fetchFileContent(url string, client *http.Client, githubToken string) (string, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
+func (l *contentsLister) relPath(path string) string {
+	if l.root == "" {
+		return path
 	}
-
-	if githubToken != "" {
-		req.Header.Set("Authorization", "token "+githubToken)
+	if path == l.root {
+		// The location is a single file
+		return filepath.Base(path)
 	}
+	return strings.TrimPrefix(path, l.root+"/")
+}
 
-	resp, err := client.Do(req)
+// fetchContents lists a directory of the contents API. A file yields itself.
+func fetchContents(url string, client *apiClient) ([]GithubContent, error) {
+	resp, err := client.get(url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, client.statusError(resp)
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(body), nil
+	var contents []GithubContent
+	err = json.Unmarshal(body, &contents)
+	if err != nil {
+		var singleFile GithubContent
+		err = json.Unmarshal(body, &singleFile)
+		if err != nil {
+			return nil, err
+		}
+		contents = []GithubContent{singleFile}
+	}
+	return contents, nil
 }
 
-func FetchUserRepos(username, githubToken string) ([]GithubRepo, error) {
-	url := fmt.Sprintf("https://api.github.com/users/%s/repos", username)
+// downloadFiles sets the content of every file whose entry in urls is not
+// empty to what that URL serves, as setFileContent does, with up to
+// concurrency workers and a progress bar counting the downloads. Results land
+// in fixed slots, so the outcome does not depend on timing.
+func downloadFiles(files []FileData, urls []string, client *apiClient, concurrency int, includeNonText bool) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	var downloads []int
+	for i, url := range urls {
+		if url != "" {
+			downloads = append(downloads, i)
+		}
+	}
+	bar := progressbar.Default(int64(len(downloads)), "Downloading files")
+
+	indices := make(chan int)
+	errs := make(chan error, concurrency)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	// The progress bar is not safe for concurrent use
+	var barMu sync.Mutex
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				content, err := fetchFileContent(urls[i], client)
+				if err != nil {
+					errs <- fmt.Errorf("error downloading %s: %v", files[i].Path, err)
+					return
+				}
+				files[i].setFileContent(content, includeNonText)
+				barMu.Lock()
+				bar.Describe(fmt.Sprintf("Downloaded: %s", filepath.Base(files[i].Path)))
+				bar.Add(1)
+				barMu.Unlock()
+			}
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var err error
+dispatch:
+	for _, i := range downloads {
+		select {
+		case indices <- i:
+		case err = <-errs:
+			break dispatch
+		}
+	}
+	close(indices)
+	<-done
 
-	if githubToken != "" {
-		req.Header.Set("Authorization", "token "+githubToken)
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+	if err == nil {
+		bar.Finish()
 	}
+	return err
+}
 
-	resp, err := client.Do(req)
+func fetchFileContent(url string, client *apiClient) ([]byte, error) {
+	resp, err := client.get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API returned status code %d", resp.StatusCode)
+		return nil, client.statusError(resp)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	return ioutil.ReadAll(resp.Body)
+}
+
+// RepoFilter selects the repositories returned by FetchUserRepos.
+type RepoFilter struct {
+	IncludeForks    bool
+	IncludeArchived bool
+	// Visibility is "all", "public" or "private"
+	Visibility string
+	// Language and Topic are ignored when empty
+	Language string
+	Topic    string
+}
+
+// Matches reports whether repo passes the filter.
+func (f RepoFilter) Matches(repo GithubRepo) bool {
+	if repo.Fork && !f.IncludeForks || repo.Archived && !f.IncludeArchived {
+		return false
+	}
+	switch f.Visibility {
+	case "public":
+		if repo.Private {
+			return false
+		}
+	case "private":
+		if !repo.Private {
+			return false
+		}
+	}
+	if f.Language != "" && !strings.EqualFold(repo.Language, f.Language) {
+		return false
+	}
+	if f.Topic != "" {
+		for _, topic := range repo.Topics {
+			if strings.EqualFold(topic, f.Topic) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// FetchUserRepos lists every repository of a user or an organization that
+// passes filter, following the API's pagination. Private repositories are only
+// listed for organizations the token can see and for the token's own user.
+// Requests go to apiURL, or to the API of github.com if it is empty, and are
+// retried like those of FetchGithubRepo.
+func FetchUserRepos(apiURL, username, githubToken string, filter RepoFilter, verbose bool) ([]GithubRepo, error) {
+	if apiURL == "" {
+		apiURL = githubAPIURL
+	}
+	client := newGitHubClient(apiURL, githubToken, verbose)
+
+	var account struct {
+		Login string `json:"login"`
+		Type  string `json:"type"`
+	}
+	if err := client.getJSON(fmt.Sprintf("%s/users/%s", apiURL, username), &account); err != nil {
 		return nil, err
 	}
 
+	url := fmt.Sprintf("%s/users/%s/repos?type=owner&per_page=100", apiURL, username)
+	if account.Type == "Organization" {
+		url = fmt.Sprintf("%s/orgs/%s/repos?type=all&per_page=100", apiURL, username)
+	} else if githubToken != "" {
+		var user struct {
+			Login string `json:"login"`
+		}
+		// Only the authenticated user's own listing includes private repositories
+		if err := client.getJSON(apiURL+"/user", &user); err == nil && strings.EqualFold(user.Login, account.Login) {
+			url = apiURL + "/user/repos?affiliation=owner&per_page=100"
+		}
+	}
+
 	var repos []GithubRepo
-	err = json.Unmarshal(body, &repos)
-	if err != nil {
-		return nil, err
+	for url != "" {
+		var page []GithubRepo
+		next, err := client.getPage(url, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range page {
+			if filter.Matches(repo) {
+				repos = append(repos, repo)
+			}
+		}
+		url = next
 	}
 
 	return repos, nil
 }
 
-func ParseGitHubURL(url string) (owner string, repo string, path string, err error) {
-	// Remove any leading "https://" or "http://"
-	url = strings.TrimPrefix(url, "https://")
-	url = strings.TrimPrefix(url, "http://")
+// GitHubLocation is a repository, and optionally a ref and a directory in it,
+// as given on the command line.
+type GitHubLocation struct {
+	// Host is github.com or the host of a GitHub Enterprise Server
+	Host  string
+	Owner string
+	Repo  string
+	RepoRef
+}
 
-	// Remove any leading "github.com/"
-	url = strings.TrimPrefix(url, "github.com/")
+// RepoRef is the ref and directory of a repository location.
+type RepoRef struct {
+	// Ref is a branch, tag or commit SHA; empty for the default branch
+	Ref  string
+	Path string
 
-	parts := strings.Split(url, "/")
+	// treePath is what follows /tree/ in a URL. Branch names may
+	// contain slashes, so where the ref ends in it is only known once the
+	// repository's refs are consulted.
+	treePath string
+}
 
-	if len(parts) < 2 {
-		return "", "", "", fmt.Errorf("invalid GitHub URL or repository format: %s", url)
+// ParseGitHubURL parses a repository URL, optionally pointing at a ref and a
+// directory as in https://github.com/owner/repo/tree/<ref>/<path>. Until the
+// location is fetched, a ref in such a URL is assumed to end at the first slash.
+// The URL may name any host; the owner/repo shorthand and other URLs without a
+// host refer to defaultHost, or to github.com if it is empty. /blob/ URLs of
+// single files are refused.
+func ParseGitHubURL(url, defaultHost string) (GitHubLocation, error) {
+	if defaultHost == "" {
+		defaultHost = DefaultGitHubHost
+	}
+	host, parts := splitRepoURL(url, defaultHost)
+	if strings.HasPrefix(url, "-") || len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return GitHubLocation{}, fmt.Errorf("invalid GitHub URL or repository format: %s", url)
 	}
 
-	owner = parts[0]
-	repo = parts[1]
+	location := GitHubLocation{Host: host, Owner: parts[0], Repo: strings.TrimSuffix(parts[1], ".git")}
 
 	if len(parts) > 2 {
+		if parts[2] == "blob" {
+			return GitHubLocation{}, errBlobURL(url)
+		}
 		if parts[2] == "tree" && len(parts) > 3 {
-			path = strings.Join(parts[4:], "/")
+			location.Ref = parts[3]
+			location.Path = strings.Join(parts[4:], "/")
+			location.treePath = strings.Join(parts[3:], "/")
 		} else {
-			path = strings.Join(parts[2:], "/")
+			location.Path = strings.Join(parts[2:], "/")
 		}
 	}
 
-	return owner, repo, path, nil
+	return location, nil
+}
+
+// errBlobURL is returned for URLs of a single file, which cannot be the root
+// of a project.
+func errBlobURL(url string) error {
+	return fmt.Errorf("%s points at a file; use the tree URL of its directory and --include to select the file", url)
+}
+
+// ParseGitHubOwner parses the URL of a user or an organization, such as
+// https://github.com/owner or just owner, into its host and name. Repository
+// URLs are accepted as well and yield their owner.
+func ParseGitHubOwner(url, defaultHost string) (string, string, error) {
+	if defaultHost == "" {
+		defaultHost = DefaultGitHubHost
+	}
+	host, parts := splitRepoURL(url, defaultHost)
+	if len(parts) < 1 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid GitHub URL or owner: %s", url)
+	}
+	return host, parts[0], nil
+}
+
+// splitRepoURL returns the host of a repository URL, or defaultHost if it has
+// none, and the path segments that follow it.
+func splitRepoURL(url, defaultHost string) (string, []string) {
+	// Remove any leading "https://" or "http://"
+	hasScheme := strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://")
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	url = strings.Trim(url, "/")
+
+	parts := strings.Split(url, "/")
+
+	// Owner names cannot contain dots or colons, so such a first part is a host
+	// (GitLab groups may contain dots and need a full URL)
+	host := defaultHost
+	if hasScheme || strings.ContainsAny(parts[0], ".:") {
+		host = strings.TrimPrefix(strings.ToLower(parts[0]), "www.")
+		parts = parts[1:]
+	}
+	return host, parts
+}
+
+// RepoURL returns the web URL of the repository, which is also its clone URL
+// without the .git suffix.
+func (l *GitHubLocation) RepoURL() string {
+	return fmt.Sprintf("https://%s/%s/%s", l.Host, l.Owner, l.Repo)
+}
+
+// SetRef overrides the ref of the location, e.g. with --ref. If the URL named
+// the same ref in /tree/<ref>/<path> form, the path is what follows it.
+func (l *RepoRef) SetRef(ref string) {
+	if l.treePath == ref {
+		l.Path = ""
+	} else if strings.HasPrefix(l.treePath, ref+"/") {
+		l.Path = l.treePath[len(ref)+1:]
+	}
+	l.Ref = ref
+	l.treePath = ""
+}
+
+// resolveTreePath splits the tree path of a URL into a ref and a path, taking
+// the shortest prefix that isRef accepts. Git refuses refs that are prefixes
+// of other refs ("a" next to "a/b"), so at most one prefix names a branch or
+// tag. If no prefix is accepted the first segment is kept as the ref.
+func (l *RepoRef) resolveTreePath(isRef func(ref string) (bool, error)) error {
+	segments := strings.Split(l.treePath, "/")
+	for i := 1; i <= len(segments); i++ {
+		ref := strings.Join(segments[:i], "/")
+		ok, err := isRef(ref)
+		if err != nil {
+			return err
+		}
+		if ok {
+			l.Ref = ref
+			l.Path = strings.Join(segments[i:], "/")
+			break
+		}
+	}
+	l.treePath = ""
+	return nil
 }
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sabhiram/go-gitignore"
+)
+
+// DefaultGitLabHost is the host of gitlab.com projects.
+const DefaultGitLabHost = "gitlab.com"
+
+// GitLabAPIURL returns the base URL of the REST API of a GitLab host.
+func GitLabAPIURL(host string) string {
+	if host == "" {
+		host = DefaultGitLabHost
+	}
+	return "https://" + host + "/api/v4"
+}
+
+// GitLabLocation is a project, and optionally a ref and a directory in it, as
+// given on the command line.
+type GitLabLocation struct {
+	// Host is gitlab.com or the host of a self-managed instance
+	Host string
+	// Project is the full path of the project, including all its groups
+	Project string
+	RepoRef
+}
+
+// ParseGitLabURL parses a project URL such as https://gitlab.com/group/project
+// or https://gitlab.com/group/subgroup/project/-/tree/<ref>/<path>. As on
+// GitHub, a ref in a /-/tree/ URL is assumed to end at the first slash until
+// the location is fetched. Since groups nest, a directory can only be given
+// after /-/tree/ or with the path of a URL. group/project shorthands refer to
+// defaultHost, or to gitlab.com if it is empty. /-/blob/ URLs are refused.
+func ParseGitLabURL(url, defaultHost string) (GitLabLocation, error) {
+	if defaultHost == "" {
+		defaultHost = DefaultGitLabHost
+	}
+	if strings.HasPrefix(url, "-") {
+		return GitLabLocation{}, fmt.Errorf("invalid GitLab URL or project format: %s", url)
+	}
+	host, parts := splitRepoURL(url, defaultHost)
+
+	project, rest := parts, []string(nil)
+	for i, part := range parts {
+		if part == "-" {
+			project, rest = parts[:i], parts[i+1:]
+			break
+		}
+	}
+
+	if len(project) < 2 {
+		return GitLabLocation{}, fmt.Errorf("invalid GitLab URL or project format: %s", url)
+	}
+	for _, part := range project {
+		if part == "" {
+			return GitLabLocation{}, fmt.Errorf("invalid GitLab URL or project format: %s", url)
+		}
+	}
+
+	location := GitLabLocation{Host: host, Project: strings.TrimSuffix(strings.Join(project, "/"), ".git")}
+	if len(rest) > 0 && rest[0] == "blob" {
+		return GitLabLocation{}, errBlobURL(url)
+	}
+	if len(rest) > 1 && rest[0] == "tree" {
+		location.Ref = rest[1]
+		location.Path = strings.Join(rest[2:], "/")
+		location.treePath = strings.Join(rest[1:], "/")
+	}
+
+	return location, nil
+}
+
+// RepoURL returns the web URL of the project, which is also its clone URL
+// without the .git suffix.
+func (l *GitLabLocation) RepoURL() string {
+	return fmt.Sprintf("https://%s/%s", l.Host, l.Project)
+}
+
+// FetchGitLabProject fetches the project, ref and directory given by location
+// with one of the FetchMethod strategies: a git clone, the repository archive
+// or the repository tree API. Like FetchGithubRepo, it records the source, ref
+// and commit SHA, updates location once a /-/tree/ URL has been resolved and
+// sends API requests to apiURL, or to the API of the location's host if it is
+// empty.
+func FetchGitLabProject(location *GitLabLocation, gitIgnore ignore.IgnoreParser, method, apiURL, gitlabToken string, concurrency int, includeGit, includeNonText, verbose bool) (ProjectData, error) {
+	method = resolveFetchMethod(method)
+	if apiURL == "" {
+		apiURL = GitLabAPIURL(location.Host)
+	}
+	client := newGitLabClient(apiURL, gitlabToken, verbose)
+
+	var projectData ProjectData
+	var err error
+	switch method {
+	case FetchMethodGit:
+		// GitLab takes access tokens as the password of any user
+		repoURL := location.RepoURL() + ".git"
+		projectData, err = fetchWithGit(repoURL, &location.RepoRef, gitAuthEnv(repoURL, "oauth2", gitlabToken), gitIgnore, includeGit, includeNonText)
+	case FetchMethodTarball:
+		projectData, err = fetchGitLabArchive(location, gitIgnore, client, includeGit, includeNonText)
+	case FetchMethodAPI:
+		projectData, err = fetchGitLabTree(location, gitIgnore, client, concurrency, includeGit, includeNonText)
+	default:
+		return ProjectData{}, fmt.Errorf("unknown fetch method %q, use auto, git, tarball or api", method)
+	}
+	if err != nil {
+		return ProjectData{}, err
+	}
+	projectData.Source = location.RepoURL()
+	return projectData, nil
+}
+
+// fetchGitLabArchive downloads the resolved commit as the repository archive.
+func fetchGitLabArchive(location *GitLabLocation, gitIgnore ignore.IgnoreParser, client *apiClient, includeGit, includeNonText bool) (ProjectData, error) {
+	commit, err := resolveGitLabCommit(location, client)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	// Entries are named <project>-<sha>-<sha>/<path>
+	archiveURL := fmt.Sprintf("%s/repository/archive.tar.gz?sha=%s", gitlabProjectURL(location, client), url.QueryEscape(commit))
+	projectData, err := downloadTarball(archiveURL, location.Path, client, gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	projectData.Ref = location.Ref
+	projectData.Commit = commit
+
+	return projectData, nil
+}
+
+// fetchGitLabTree lists the directory of location with the recursive tree API
+// and downloads the files that pass the patterns with up to concurrency
+// requests at a time.
+func fetchGitLabTree(location *GitLabLocation, gitIgnore ignore.IgnoreParser, client *apiClient, concurrency int, includeGit, includeNonText bool) (ProjectData, error) {
+	commit, err := resolveGitLabCommit(location, client)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	projectURL := gitlabProjectURL(location, client)
+	treeURL := fmt.Sprintf("%s/repository/tree?ref=%s&recursive=true&per_page=100", projectURL, url.QueryEscape(commit))
+	root := strings.Trim(location.Path, "/")
+	if root != "" {
+		treeURL += "&path=" + url.QueryEscape(root)
+	}
+
+	var entries []GitlabTreeEntry
+	for treeURL != "" {
+		var page []GitlabTreeEntry
+		next, err := client.getPage(treeURL, &page)
+		if err != nil {
+			return ProjectData{}, err
+		}
+		entries = append(entries, page...)
+		treeURL = next
+	}
+
+	var projectData ProjectData
+	var urls []string
+	for _, entry := range entries {
+		path := entry.Path
+		if root != "" {
+			path = strings.TrimPrefix(path, root+"/")
+		}
+
+		switch entry.Type {
+		case "tree":
+			projectData.Directories = append(projectData.Directories, path)
+		case "blob":
+			projectData.Files = append(projectData.Files, FileData{Path: path})
+			rawURL := ""
+			if matchesPathPatterns(path, gitIgnore, includeGit) {
+				rawURL = fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", projectURL, url.PathEscape(entry.Path), url.QueryEscape(commit))
+			}
+			urls = append(urls, rawURL)
+		}
+	}
+
+	err = downloadFiles(projectData.Files, urls, client, concurrency, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	sort.Strings(projectData.Directories)
+	sort.Slice(projectData.Files, func(i, j int) bool {
+		return projectData.Files[i].Path < projectData.Files[j].Path
+	})
+	projectData.Ref = location.Ref
+	projectData.Commit = commit
+
+	return projectData, nil
+}
+
+// gitlabProjectURL returns the API URL of the project, which GitLab addresses
+// by its URL-encoded full path.
+func gitlabProjectURL(location *GitLabLocation, client *apiClient) string {
+	return fmt.Sprintf("%s/projects/%s", client.baseURL, url.PathEscape(location.Project))
+}
+
+// resolveGitLabCommit resolves the ref of location, splitting a /-/tree/ URL
+// into a ref and a path first, to a commit SHA with the GitLab API.
+func resolveGitLabCommit(location *GitLabLocation, client *apiClient) (string, error) {
+	projectURL := gitlabProjectURL(location, client)
+	if location.treePath != "" {
+		err := location.resolveTreePath(func(ref string) (bool, error) {
+			_, err := fetchGitLabCommit(projectURL, ref, client)
+			if err == errRefNotFound {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	ref := location.Ref
+	if ref == "" {
+		var project struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		if err := client.getJSON(projectURL, &project); err != nil {
+			return "", err
+		}
+		ref = project.DefaultBranch
+	}
+
+	commit, err := fetchGitLabCommit(projectURL, ref, client)
+	if err == errRefNotFound {
+		return "", fmt.Errorf("ref %q not found in %s", ref, location.Project)
+	}
+	return commit, err
+}
+
+// fetchGitLabCommit resolves ref to a commit SHA.
+func fetchGitLabCommit(projectURL, ref string, client *apiClient) (string, error) {
+	resp, err := client.get(projectURL + "/repository/commits/" + url.PathEscape(ref))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errRefNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", client.statusError(resp)
+	}
+
+	var commit struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&commit); err != nil {
+		return "", err
+	}
+	return commit.ID, nil
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseGitLabURL(t *testing.T) {
+	testCases := []struct {
+		url, defaultHost, host, project, ref, path string
+	}{
+		{"group/project", "", "gitlab.com", "group/project", "", ""},
+		{"https://gitlab.com/group/subgroup/project.git", "", "gitlab.com", "group/subgroup/project", "", ""},
+		{"group/subgroup/project", "git.example.com", "git.example.com", "group/subgroup/project", "", ""},
+		{"https://git.example.com/group/sub/project/-/tree/main", "", "git.example.com", "group/sub/project", "main", ""},
+		{"https://gitlab.com/my.group/project/-/tree/feature/x/docs/api", "", "gitlab.com", "my.group/project", "feature/x", "docs/api"},
+	}
+
+	refs := map[string]bool{"main": true, "feature/x": true}
+	for _, tc := range testCases {
+		location, err := ParseGitLabURL(tc.url, tc.defaultHost)
+		if err != nil {
+			t.Fatalf("ParseGitLabURL(%q) failed: %v", tc.url, err)
+		}
+		if location.treePath != "" {
+			location.resolveTreePath(func(ref string) (bool, error) { return refs[ref], nil })
+		}
+		if location.Host != tc.host || location.Project != tc.project || location.Ref != tc.ref || location.Path != tc.path {
+			t.Errorf("ParseGitLabURL(%q) = %+v, want %s %s ref %q path %q", tc.url, location, tc.host, tc.project, tc.ref, tc.path)
+		}
+	}
+
+	if _, err := ParseGitLabURL("https://gitlab.com/project", ""); err == nil {
+		t.Errorf("ParseGitLabURL accepted a project without a group")
+	}
+	if _, err := ParseGitLabURL("--upload-pack=touch/x", ""); err == nil {
+		t.Errorf("ParseGitLabURL accepted a URL starting with -")
+	}
+	if _, err := ParseGitLabURL("https://gitlab.com/group/project/-/blob/main/README.md", ""); err == nil || !strings.Contains(err.Error(), "points at a file") {
+		t.Errorf("ParseGitLabURL of a blob URL = %v", err)
+	}
+}
+
+// newGitLabTestServer serves the commits, archive, tree and raw file endpoints
+// of the project group/sub/project below /api/v4 with a "main" branch.
+func newGitLabTestServer(t *testing.T) *httptest.Server {
+	const sha = "89abcdef0123456789abcdef0123456789abcdef"
+	const projectPath = "/api/v4/projects/group%2Fsub%2Fproject"
+	files := map[string]string{"README.md": "# Project\n", "docs/guide.md": "# Guide\n", "docs/notes.txt": "notes\n"}
+
+	archive := tarGz(t, "project-"+sha+"-"+sha+"/", map[string]string{
+		"":               "",
+		"README.md":      files["README.md"],
+		"docs/":          "",
+		"docs/guide.md":  files["docs/guide.md"],
+		"docs/notes.txt": files["docs/notes.txt"],
+	})
+
+	tree := []GitlabTreeEntry{
+		{Path: "README.md", Type: "blob"},
+		{Path: "docs", Type: "tree"},
+		{Path: "docs/guide.md", Type: "blob"},
+		{Path: "docs/notes.txt", Type: "blob"},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		if r.Header.Get("Private-Token") != "secret" {
+			http.Error(w, `{"message": "401 Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case path == projectPath:
+			fmt.Fprint(w, `{"default_branch": "main"}`)
+		case path == projectPath+"/repository/commits/main":
+			fmt.Fprintf(w, `{"id": %q}`, sha)
+		case strings.HasPrefix(path, projectPath+"/repository/commits/"):
+			http.Error(w, `{"message": "404 Commit Not Found"}`, http.StatusNotFound)
+		case path == projectPath+"/repository/archive.tar.gz" && r.URL.Query().Get("sha") == sha:
+			w.Write(archive)
+		case path == projectPath+"/repository/tree" && r.URL.Query().Get("ref") == sha:
+			prefix := r.URL.Query().Get("path")
+			var entries []GitlabTreeEntry
+			for _, entry := range tree {
+				if prefix == "" || strings.HasPrefix(entry.Path, prefix+"/") {
+					entries = append(entries, entry)
+				}
+			}
+			// One entry per page exercises the pagination
+			page := 0
+			fmt.Sscan(r.URL.Query().Get("page"), &page)
+			if page < len(entries)-1 {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?ref=%s&path=%s&page=%d>; rel="next"`, r.Host, path, sha, prefix, page+1))
+			}
+			json.NewEncoder(w).Encode(entries[page : page+1])
+		case strings.HasPrefix(path, projectPath+"/repository/files/") && r.URL.Query().Get("ref") == sha:
+			name := strings.TrimSuffix(strings.TrimPrefix(path, projectPath+"/repository/files/"), "/raw")
+			name = strings.ReplaceAll(name, "%2F", "/")
+			fmt.Fprint(w, files[name])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestFetchGitLabProject(t *testing.T) {
+	server := newGitLabTestServer(t)
+	defer server.Close()
+	apiURL := server.URL + "/api/v4"
+
+	for _, method := range []string{FetchMethodTarball, FetchMethodAPI} {
+		location, _ := ParseGitLabURL("https://git.example.com/group/sub/project", "")
+		gitIgnore := CreateGitIgnoreMatcher([]string{"*.txt"})
+		projectData, err := FetchGitLabProject(&location, gitIgnore, method, apiURL, "secret", 2, false, false, false)
+		if err != nil {
+			t.Fatalf("FetchGitLabProject(%s) failed: %v", method, err)
+		}
+		if projectData.Source != "https://git.example.com/group/sub/project" || projectData.Commit != "89abcdef0123456789abcdef0123456789abcdef" {
+			t.Errorf("%s: unexpected source information: %q %q", method, projectData.Source, projectData.Commit)
+		}
+		var files []string
+		for _, file := range projectData.Files {
+			if file.Content != "" {
+				files = append(files, file.Path)
+			}
+		}
+		if strings.Join(files, ",") != "README.md,docs/guide.md" || strings.Join(projectData.Directories, ",") != "docs" {
+			t.Errorf("%s: unexpected project: %v %v", method, projectData.Directories, files)
+		}
+
+		location, _ = ParseGitLabURL("https://git.example.com/group/sub/project/-/tree/main/docs", "")
+		projectData, err = FetchGitLabProject(&location, CreateGitIgnoreMatcher(nil), method, apiURL, "secret", 2, false, false, false)
+		if err != nil {
+			t.Fatalf("FetchGitLabProject(%s) failed: %v", method, err)
+		}
+		if paths := getFilePaths(projectData.Files); strings.Join(paths, ",") != "guide.md,notes.txt" || projectData.Ref != "main" {
+			t.Errorf("%s: unexpected directory fetch: %v at %q", method, paths, projectData.Ref)
+		}
+
+		location.SetRef("missing")
+		if _, err := FetchGitLabProject(&location, CreateGitIgnoreMatcher(nil), method, apiURL, "secret", 2, false, false, false); err == nil {
+			t.Errorf("%s: FetchGitLabProject accepted a missing ref", method)
+		}
+	}
+
+	location, _ := ParseGitLabURL("group/sub/project", "")
+	if _, err := FetchGitLabProject(&location, CreateGitIgnoreMatcher(nil), FetchMethodAPI, apiURL, "", 2, false, false, false); err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("FetchGitLabProject without a token = %v, want the API's message", err)
+	}
+}
@@ -0,0 +1,413 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabhiram/go-gitignore"
+	"github.com/schollz/progressbar/v3"
+)
+
+// DefaultGoProxy is the GOPROXY setting the go command uses when it is unset.
+const DefaultGoProxy = "https://proxy.golang.org,direct"
+
+// DefaultGoSumDB is the checksum database the go command uses when GOSUMDB is
+// unset.
+const DefaultGoSumDB = "sum.golang.org"
+
+// errNotOnProxy is returned for modules and versions a proxy does not serve,
+// which makes the next proxy in the GOPROXY list be tried.
+var errNotOnProxy = errors.New("not found on module proxy")
+
+// goModuleInfo is the .info metadata of a module version.
+type goModuleInfo struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+	// Origin is sent by proxies for versions fetched with a recent go command
+	Origin *struct {
+		VCS  string `json:"VCS"`
+		URL  string `json:"URL"`
+		Hash string `json:"Hash"`
+	} `json:"Origin"`
+}
+
+// goProxyEntry is one proxy of a GOPROXY list.
+type goProxyEntry struct {
+	url string
+	// fallback is true if any error makes the next proxy be tried, as after
+	// a "|"; after a "," only modules the proxy does not have do
+	fallback bool
+}
+
+// FetchGoModule downloads a version of a Go module with the module proxy
+// protocol and dumps the files of its zip without the module@version/ prefix.
+// version is a semantic version or "latest", the default. proxy is a GOPROXY
+// style list of proxy URLs separated by "," or "|"; if it is empty, the
+// GOPROXY environment variable or the go command's default is used. Modules
+// matching GONOPROXY or GOPRIVATE are refused, since fetching them directly
+// from version control is not supported. If goSumPath is set, the zip must
+// match the hash recorded for the version in that go.sum file. Checksum
+// databases are not consulted, so without a go.sum a warning is printed for
+// modules the go command would check against GOSUMDB, that is unless it is
+// off or the module matches GONOSUMDB or GOPRIVATE. The module path, version
+// and, if the proxy knows it, commit are recorded.
+func FetchGoModule(proxy, modulePath, version, goSumPath string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	if version == "" {
+		version = "latest"
+	}
+	if proxy == "" {
+		proxy = os.Getenv("GOPROXY")
+	}
+	if proxy == "" {
+		proxy = DefaultGoProxy
+	}
+
+	noProxy := os.Getenv("GONOPROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("GOPRIVATE")
+	}
+	if matchModulePatterns(noProxy, modulePath) {
+		return ProjectData{}, fmt.Errorf("%s matches GONOPROXY or GOPRIVATE and fetching modules directly from version control is not supported", modulePath)
+	}
+
+	var lastErr error
+	for _, entry := range parseGoProxy(proxy) {
+		switch entry.url {
+		case "off":
+			return ProjectData{}, fmt.Errorf("module lookup disabled by GOPROXY=off")
+		case "direct":
+			if lastErr != nil {
+				return ProjectData{}, fmt.Errorf("%v (fetching modules directly from version control is not supported)", lastErr)
+			}
+			return ProjectData{}, fmt.Errorf("fetching modules directly from version control is not supported, set a module proxy")
+		}
+
+		projectData, err := fetchFromGoProxy(entry.url, modulePath, version, goSumPath, gitIgnore, includeGit, includeNonText)
+		if err == nil {
+			return projectData, nil
+		}
+		if !entry.fallback && !errors.Is(err, errNotOnProxy) {
+			return ProjectData{}, err
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no module proxy configured")
+	}
+	return ProjectData{}, lastErr
+}
+
+// fetchFromGoProxy resolves and downloads the module version from one proxy.
+func fetchFromGoProxy(proxyURL, modulePath, version, goSumPath string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	client := newAPIClient("Go module proxy", proxyURL, false)
+	moduleURL := client.baseURL + "/" + escapeModulePath(modulePath)
+
+	info, err := resolveGoModuleVersion(client, moduleURL, version)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	var expectedSum string
+	if goSumPath != "" {
+		expectedSum, err = goSumHash(goSumPath, modulePath, info.Version)
+		if err != nil {
+			return ProjectData{}, err
+		}
+	} else if sumDB := goSumDB(modulePath); sumDB != "" {
+		fmt.Fprintf(client.log, "Warning: %s@%s is not verified; the go command checks it against %s, which onefile does not consult, so pass a go.sum to verify it\n", modulePath, info.Version, sumDB)
+	}
+
+	resp, err := goProxyGet(client, moduleURL+"/@v/"+escapeModulePath(info.Version)+".zip")
+	if err != nil {
+		return ProjectData{}, err
+	}
+	defer resp.Body.Close()
+
+	// Zip archives are read from the end, so the download is kept on disk
+	tmpFile, err := ioutil.TempFile("", "onefile-module-*.zip")
+	if err != nil {
+		return ProjectData{}, err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	bar := progressbar.DefaultBytes(resp.ContentLength, "Downloading module")
+	size, err := io.Copy(tmpFile, io.TeeReader(resp.Body, bar))
+	if err != nil {
+		return ProjectData{}, err
+	}
+	bar.Finish()
+
+	r, err := zip.NewReader(tmpFile, size)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	if expectedSum != "" {
+		sum, err := hashModuleZip(r)
+		if err != nil {
+			return ProjectData{}, err
+		}
+		if sum != expectedSum {
+			return ProjectData{}, fmt.Errorf("checksum mismatch for %s@%s: downloaded %s, go.sum has %s", modulePath, info.Version, sum, expectedSum)
+		}
+	}
+
+	projectData, err := extractZip(r, modulePath+"@"+info.Version+"/", gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+
+	sort.Strings(projectData.Directories)
+	sort.Slice(projectData.Files, func(i, j int) bool {
+		return projectData.Files[i].Path < projectData.Files[j].Path
+	})
+	projectData.Source = modulePath
+	projectData.Ref = info.Version
+	if info.Origin != nil {
+		projectData.Commit = info.Origin.Hash
+	}
+	// Zip entries carry no meaningful times, so files take the version's time
+	if !info.Time.IsZero() {
+		setModTimes(&projectData, info.Time)
+	}
+
+	return projectData, nil
+}
+
+// resolveGoModuleVersion looks up the .info of version, or of the latest
+// version for "latest". Proxies without @latest are asked for their list of
+// versions, of which the highest release is taken.
+func resolveGoModuleVersion(client *apiClient, moduleURL, version string) (goModuleInfo, error) {
+	var info goModuleInfo
+	if version != "latest" {
+		err := goProxyGetJSON(client, moduleURL+"/@v/"+escapeModulePath(version)+".info", &info)
+		return info, err
+	}
+
+	err := goProxyGetJSON(client, moduleURL+"/@latest", &info)
+	if err == nil || !errors.Is(err, errNotOnProxy) {
+		return info, err
+	}
+
+	resp, err := goProxyGet(client, moduleURL+"/@v/list")
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return info, err
+	}
+
+	latest := latestSemver(strings.Fields(string(body)))
+	if latest == "" {
+		return info, fmt.Errorf("%w: no versions listed at %s", errNotOnProxy, moduleURL)
+	}
+	err = goProxyGetJSON(client, moduleURL+"/@v/"+escapeModulePath(latest)+".info", &info)
+	return info, err
+}
+
+// goProxyGet requests url from a module proxy. 404 and 410 responses, which
+// proxies send for modules and versions they do not have, yield errNotOnProxy.
+func goProxyGet(client *apiClient, url string) (*http.Response, error) {
+	resp, err := client.get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		// Proxies explain what is missing in a plain text body
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%w: %s", errNotOnProxy, strings.TrimSpace(string(body)))
+	}
+	return nil, client.statusError(resp)
+}
+
+func goProxyGetJSON(client *apiClient, url string, v interface{}) error {
+	resp, err := goProxyGet(client, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// goSumDB returns the name of the checksum database the go command verifies
+// modulePath against, or "" if GOSUMDB is off or the module matches GONOSUMDB
+// or GOPRIVATE.
+func goSumDB(modulePath string) string {
+	sumDB := strings.TrimSpace(os.Getenv("GOSUMDB"))
+	if sumDB == "off" {
+		return ""
+	}
+	noSumDB := os.Getenv("GONOSUMDB")
+	if noSumDB == "" {
+		noSumDB = os.Getenv("GOPRIVATE")
+	}
+	if matchModulePatterns(noSumDB, modulePath) {
+		return ""
+	}
+	if sumDB == "" {
+		return DefaultGoSumDB
+	}
+	// GOSUMDB may carry a public key and URL after the name
+	return strings.Fields(sumDB)[0]
+}
+
+// parseGoProxy splits a GOPROXY list into its entries.
+func parseGoProxy(proxy string) []goProxyEntry {
+	var entries []goProxyEntry
+	for proxy != "" {
+		end := strings.IndexAny(proxy, ",|")
+		entry := goProxyEntry{url: proxy}
+		if end >= 0 {
+			entry = goProxyEntry{url: proxy[:end], fallback: proxy[end] == '|'}
+			proxy = proxy[end+1:]
+		} else {
+			proxy = ""
+		}
+		if entry.url = strings.TrimSpace(entry.url); entry.url != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// matchModulePatterns reports whether a comma-separated list of glob patterns,
+// as in GOPRIVATE, matches the module path or one of its prefixes. A pattern
+// with n slashes is matched against the first n+1 elements of the path.
+func matchModulePatterns(patterns, modulePath string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		elements := strings.Count(pattern, "/") + 1
+		parts := strings.Split(modulePath, "/")
+		if len(parts) < elements {
+			continue
+		}
+		if matched, _ := path.Match(pattern, strings.Join(parts[:elements], "/")); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeModulePath applies the case encoding of the module proxy protocol to a
+// module path or version: every upper-case letter becomes "!" followed by the
+// letter in lower case.
+func escapeModulePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// hashModuleZip computes the "h1:" hash of a module zip that go.sum records:
+// the SHA-256 of a summary listing the SHA-256 and name of every file.
+func hashModuleZip(r *zip.Reader) (string, error) {
+	files := make([]*zip.File, len(r.File))
+	copy(files, r.File)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	summary := sha256.New()
+	for _, f := range files {
+		if strings.Contains(f.Name, "\n") {
+			return "", fmt.Errorf("module zip has a file name with a newline: %q", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), f.Name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
+
+// goSumHash returns the hash of the module version's zip from a go.sum file.
+func goSumHash(goSumPath, modulePath, version string) (string, error) {
+	file, err := os.Open(goSumPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines are "<module> <version> <hash>", and "<version>/go.mod" for
+		// the hash of the go.mod file alone
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == modulePath && fields[1] == version {
+			return fields[2], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no entry for %s@%s", goSumPath, modulePath, version)
+}
+
+// GoModVersion returns the version of modulePath that the go.mod file at
+// goModPath requires, from single-line and parenthesized require directives.
+func GoModVersion(goModPath, modulePath string) (string, error) {
+	data, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return "", err
+	}
+
+	inRequire := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inRequire && fields[0] == ")":
+			inRequire = false
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		case !inRequire:
+			continue
+		}
+		if len(fields) >= 2 && strings.Trim(fields[0], `"`) == modulePath {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("%s does not require %s", goModPath, modulePath)
+}
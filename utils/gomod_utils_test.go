@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareSemver(t *testing.T) {
+	// Each version sorts before the next
+	ordered := []string{"v1.0.0-alpha", "v1.0.0-alpha.1", "v1.0.0-alpha.beta", "v1.0.0-beta.2", "v1.0.0-beta.11", "v1.0.0-rc.1", "v1.0.0", "1.0.1", "v1.2.0", "v1.10.0", "v2.0.0"}
+	for i := 0; i+1 < len(ordered); i++ {
+		if c := compareSemver(ordered[i], ordered[i+1]); c != -1 {
+			t.Errorf("compareSemver(%q, %q) = %d, want -1", ordered[i], ordered[i+1], c)
+		}
+		if c := compareSemver(ordered[i+1], ordered[i]); c != 1 {
+			t.Errorf("compareSemver(%q, %q) = %d, want 1", ordered[i+1], ordered[i], c)
+		}
+	}
+	if c := compareSemver("v1.0.0+build.1", "1.0.0"); c != 0 {
+		t.Errorf("Build metadata changed the precedence: %d", c)
+	}
+	for _, invalid := range []string{"v1.0", "v01.0.0", "v1.0.0-", "latest"} {
+		if _, ok := parseSemver(invalid); ok {
+			t.Errorf("parseSemver accepted %q", invalid)
+		}
+	}
+
+	if latest := latestSemver([]string{"v1.2.0-rc.1", "v1.1.0", "junk", "v1.0.0"}); latest != "v1.1.0" {
+		t.Errorf("latestSemver preferred %s to the highest release", latest)
+	}
+	if latest := latestSemver([]string{"v0.1.0-alpha", "v0.1.0-beta"}); latest != "v0.1.0-beta" {
+		t.Errorf("latestSemver without releases = %s", latest)
+	}
+}
+
+func TestGoProxySettings(t *testing.T) {
+	entries := parseGoProxy("https://a.example.com|https://b.example.com,direct")
+	expected := []goProxyEntry{{"https://a.example.com", true}, {"https://b.example.com", false}, {"direct", false}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("parseGoProxy = %v, want %v", entries, expected)
+	}
+
+	testCases := []struct {
+		patterns, module string
+		match            bool
+	}{
+		{"example.com", "example.com/org/mod", true},
+		{"*.corp.example.com", "git.corp.example.com/team/mod", true},
+		{"example.com/org", "example.com/other/mod", false},
+		{"example.com/*/mod", "example.com/org/mod/v2", true},
+		{"example.com/org/mod/sub", "example.com/org/mod", false},
+		{"", "example.com/org/mod", false},
+	}
+	for _, tc := range testCases {
+		if match := matchModulePatterns(tc.patterns, tc.module); match != tc.match {
+			t.Errorf("matchModulePatterns(%q, %q) = %v", tc.patterns, tc.module, match)
+		}
+	}
+
+	if escaped := escapeModulePath("github.com/BurntSushi/toml"); escaped != "github.com/!burnt!sushi/toml" {
+		t.Errorf("escapeModulePath = %s", escaped)
+	}
+
+	for _, key := range []string{"GOSUMDB", "GONOSUMDB", "GOPRIVATE"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+	sumDBCases := []struct {
+		sumDB, noSumDB, private, module, expected string
+	}{
+		{"", "", "", "example.com/org/mod", DefaultGoSumDB},
+		{"sum.example.com+key https://sum.example.com", "", "", "example.com/org/mod", "sum.example.com+key"},
+		{"off", "", "", "example.com/org/mod", ""},
+		{"", "example.com/org", "", "example.com/org/mod", ""},
+		{"", "", "*.corp.example.com", "git.corp.example.com/mod", ""},
+		{"", "other.com", "example.com", "example.com/org/mod", DefaultGoSumDB},
+	}
+	for _, tc := range sumDBCases {
+		os.Setenv("GOSUMDB", tc.sumDB)
+		os.Setenv("GONOSUMDB", tc.noSumDB)
+		os.Setenv("GOPRIVATE", tc.private)
+		if sumDB := goSumDB(tc.module); sumDB != tc.expected {
+			t.Errorf("goSumDB(%q) with GOSUMDB=%q GONOSUMDB=%q GOPRIVATE=%q = %q, want %q", tc.module, tc.sumDB, tc.noSumDB, tc.private, sumDB, tc.expected)
+		}
+	}
+}
+
+// goModuleZip builds the zip of a module version as the go command does.
+func goModuleZip(t *testing.T, module, version string, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"go.mod", "main.go", "internal/util.go"} {
+		w, err := zw.Create(module + "@" + version + "/" + name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchGoModule(t *testing.T) {
+	const module = "example.com/Org/mod"
+	files := map[string]string{
+		"go.mod":           "module example.com/Org/mod\n\ngo 1.16\n",
+		"main.go":          "package main\n",
+		"internal/util.go": "package internal\n",
+	}
+	zips := map[string][]byte{
+		"v1.0.0": goModuleZip(t, module, "v1.0.0", files),
+		"v1.1.0": goModuleZip(t, module, "v1.1.0", files),
+	}
+
+	// The first proxy has nothing, the second has no @latest endpoint
+	empty := httptest.NewServer(http.NotFoundHandler())
+	defer empty.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/example.com/!org/mod/@v/")
+		switch {
+		case path == "list":
+			fmt.Fprint(w, "v1.0.0\nv1.1.0\nv1.2.0-rc.1\n")
+		case strings.HasSuffix(path, ".info"):
+			version := strings.TrimSuffix(path, ".info")
+			fmt.Fprintf(w, `{"Version": %q, "Time": "2024-01-02T03:04:05Z", "Origin": {"VCS": "git", "Hash": "0123456789abcdef0123456789abcdef01234567"}}`, version)
+		case strings.HasSuffix(path, ".zip") && zips[strings.TrimSuffix(path, ".zip")] != nil:
+			w.Write(zips[strings.TrimSuffix(path, ".zip")])
+		default:
+			http.Error(w, "not found: "+r.URL.Path, http.StatusNotFound)
+		}
+	}))
+	defer proxy.Close()
+
+	tmpDir, err := ioutil.TempDir("", "onefile-gomod-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// The hash of v1.0.0 is the one go mod download computes for this zip
+	goSum := filepath.Join(tmpDir, "go.sum")
+	sums := module + " v1.0.0 h1:z1LEE31wNoNkGtr81F2qX3klZZc6/1HnuGNgkNVPIDw=\n" +
+		module + " v1.0.0/go.mod h1:iIcP44XvRE5XvH3q7PhDSu0jZyS3bptbepBJxzraX0c=\n" +
+		module + " v1.1.0 h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"
+	if err := ioutil.WriteFile(goSum, []byte(sums), 0644); err != nil {
+		t.Fatalf("Failed to write go.sum: %v", err)
+	}
+	goMod := filepath.Join(tmpDir, "go.mod")
+	if err := ioutil.WriteFile(goMod, []byte("module example.com/app\n\nrequire (\n\texample.com/other v0.1.0\n\texample.com/Org/mod v1.0.0 // indirect\n)\n"), 0644); err != nil {
+		t.Fatalf("Failed to write go.mod: %v", err)
+	}
+
+	proxies := empty.URL + "," + proxy.URL
+	projectData, err := FetchGoModule(proxies, module, "", "", CreateGitIgnoreMatcher(nil), false, false)
+	if err != nil {
+		t.Fatalf("FetchGoModule failed: %v", err)
+	}
+	if paths := getFilePaths(projectData.Files); strings.Join(paths, ",") != "go.mod,internal/util.go,main.go" {
+		t.Errorf("Unexpected files: %v", paths)
+	}
+	if projectData.Source != module || projectData.Ref != "v1.1.0" || projectData.Commit != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("Unexpected source information: %q %q %q", projectData.Source, projectData.Ref, projectData.Commit)
+	}
+
+	version, err := GoModVersion(goMod, module)
+	if err != nil || version != "v1.0.0" {
+		t.Fatalf("GoModVersion = %q, %v", version, err)
+	}
+	if _, err := FetchGoModule(proxies, module, version, goSum, CreateGitIgnoreMatcher(nil), false, false); err != nil {
+		t.Errorf("FetchGoModule with a matching go.sum failed: %v", err)
+	}
+	if _, err := FetchGoModule(proxies, module, "v1.1.0", goSum, CreateGitIgnoreMatcher(nil), false, false); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("FetchGoModule with a mismatching go.sum = %v", err)
+	}
+
+	if _, err := FetchGoModule(proxies, module, "v9.0.0", "", CreateGitIgnoreMatcher(nil), false, false); err == nil {
+		t.Errorf("FetchGoModule accepted a missing version")
+	}
+	if _, err := FetchGoModule("off", module, "", "", CreateGitIgnoreMatcher(nil), false, false); err == nil {
+		t.Errorf("FetchGoModule ignored GOPROXY=off")
+	}
+}
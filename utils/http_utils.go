@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// apiMaxRetries is how often a failed request is retried
+	apiMaxRetries = 4
+	// apiMaxBackoff caps the exponential backoff between retries
+	apiMaxBackoff = 30 * time.Second
+	// apiMaxRateLimitWait is the longest wait for a rate limit to reset;
+	// requests fail instead of waiting longer
+	apiMaxRateLimitWait = 5 * time.Minute
+)
+
+// apiClient sends GET requests to a REST API such as GitHub's. It retries
+// network errors and server errors with exponential backoff, waits for short
+// rate limits to reset, fails with an explanation on long ones and, in
+// verbose mode, reports the remaining quota after every request.
+type apiClient struct {
+	client *http.Client
+	// baseURL is the API root that request URLs are built on
+	baseURL string
+	service string
+	header  http.Header
+	verbose bool
+	log     io.Writer
+
+	// Names of the headers carrying the rate limit quota
+	limitHeader, remainingHeader, resetHeader string
+
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// newGitHubClient returns an apiClient for the GitHub API at apiURL that
+// authenticates with githubToken if it is set.
+func newGitHubClient(apiURL, githubToken string, verbose bool) *apiClient {
+	c := newAPIClient("GitHub", apiURL, verbose)
+	if githubToken != "" {
+		c.header.Set("Authorization", "token "+githubToken)
+	}
+	c.limitHeader = "X-RateLimit-Limit"
+	c.remainingHeader = "X-RateLimit-Remaining"
+	c.resetHeader = "X-RateLimit-Reset"
+	return c
+}
+
+// newGitLabClient returns an apiClient for the GitLab API at apiURL that
+// authenticates with a personal, project or group access token if it is set.
+func newGitLabClient(apiURL, gitlabToken string, verbose bool) *apiClient {
+	c := newAPIClient("GitLab", apiURL, verbose)
+	if gitlabToken != "" {
+		c.header.Set("Private-Token", gitlabToken)
+	}
+	c.limitHeader = "RateLimit-Limit"
+	c.remainingHeader = "RateLimit-Remaining"
+	c.resetHeader = "RateLimit-Reset"
+	return c
+}
+
+func newAPIClient(service, apiURL string, verbose bool) *apiClient {
+	return &apiClient{
+		client:  &http.Client{},
+		baseURL: strings.TrimSuffix(apiURL, "/"),
+		service: service,
+		header:  make(http.Header),
+		verbose: verbose,
+		log:     os.Stderr,
+		sleep:   time.Sleep,
+		now:     time.Now,
+	}
+}
+
+// get requests url with the client's headers and any extra header lines given
+// as name, value pairs. The response is returned whatever its status once
+// retrying is over; the caller must close its body.
+func (c *apiClient) get(url string, extraHeader ...string) (*http.Response, error) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range c.header {
+			req.Header[name] = values
+		}
+		for i := 0; i+1 < len(extraHeader); i += 2 {
+			req.Header.Set(extraHeader[i], extraHeader[i+1])
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			if attempt >= apiMaxRetries {
+				return nil, err
+			}
+			fmt.Fprintf(c.log, "%s API request failed (%v), retrying in %s\n", c.service, err, backoff)
+			c.sleep(backoff)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		c.reportQuota(resp)
+
+		if wait, limited := c.rateLimitWait(resp); limited {
+			err := c.rateLimitError(resp)
+			resp.Body.Close()
+			if wait > apiMaxRateLimitWait || attempt >= apiMaxRetries {
+				return nil, err
+			}
+			if wait == 0 {
+				// Nothing tells when the limit lifts, so back off as for errors
+				wait = backoff
+				backoff = nextBackoff(backoff)
+			}
+			fmt.Fprintf(c.log, "%s API rate limit reached, waiting %s\n", c.service, wait)
+			c.sleep(wait)
+			continue
+		}
+
+		if resp.StatusCode >= 500 && attempt < apiMaxRetries {
+			resp.Body.Close()
+			wait := backoff
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), c.now()); ok {
+				wait = retryAfter
+			}
+			fmt.Fprintf(c.log, "%s API returned status code %d, retrying in %s\n", c.service, resp.StatusCode, wait)
+			c.sleep(wait)
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		return resp, nil
+	}
+}
+
+// getJSON requests url and decodes a successful response into v.
+func (c *apiClient) getJSON(url string, v interface{}) error {
+	resp, err := c.get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.statusError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getPage decodes one page of an API listing into v and returns the URL of
+// the next page from the Link header, or "" for the last page.
+func (c *apiClient) getPage(url string, v interface{}) (string, error) {
+	resp, err := c.get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", c.statusError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", err
+	}
+	return nextPageURL(resp.Header.Get("Link")), nil
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPageURL extracts the rel="next" URL from a Link header.
+func nextPageURL(link string) string {
+	if m := linkNext.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// statusError describes an unexpected response, including the message the API
+// sent with it.
+func (c *apiClient) statusError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return fmt.Errorf("%s API returned status code %d: %s", c.service, resp.StatusCode, body.Message)
+	}
+	return fmt.Errorf("%s API returned status code %d", c.service, resp.StatusCode)
+}
+
+// rateLimitWait reports whether resp was refused because of a rate limit and
+// how long to wait before trying again, or 0 if the response does not say.
+func (c *apiClient) rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), c.now()); ok {
+		return wait, true
+	}
+	if resp.Header.Get(c.remainingHeader) != "0" {
+		// A 403 with quota left is a permission problem
+		return 0, resp.StatusCode == http.StatusTooManyRequests
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get(c.resetHeader), 10, 64)
+	if err != nil {
+		return apiMaxBackoff, true
+	}
+	wait := time.Unix(reset, 0).Sub(c.now()) + time.Second
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, true
+}
+
+func (c *apiClient) rateLimitError(resp *http.Response) error {
+	message := fmt.Sprintf("%s API rate limit exceeded", c.service)
+	if limit := resp.Header.Get(c.limitHeader); limit != "" {
+		message += fmt.Sprintf(" (limit of %s requests)", limit)
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get(c.resetHeader), 10, 64); err == nil {
+		message += fmt.Sprintf("; it resets at %s", time.Unix(reset, 0).Format("15:04:05"))
+	}
+	if c.header.Get("Authorization") == "" && c.header.Get("Private-Token") == "" {
+		message += "; authenticate with a token for a higher limit"
+	}
+	return fmt.Errorf("%s", message)
+}
+
+func (c *apiClient) reportQuota(resp *http.Response) {
+	remaining := resp.Header.Get(c.remainingHeader)
+	if !c.verbose || remaining == "" {
+		return
+	}
+	message := fmt.Sprintf("%s API quota: %s", c.service, remaining)
+	if limit := resp.Header.Get(c.limitHeader); limit != "" {
+		message += " of " + limit
+	}
+	message += " requests left"
+	if reset, err := strconv.ParseInt(resp.Header.Get(c.resetHeader), 10, 64); err == nil {
+		message += fmt.Sprintf(", resets at %s", time.Unix(reset, 0).Format("15:04:05"))
+	}
+	fmt.Fprintln(c.log, message)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > apiMaxBackoff {
+		return apiMaxBackoff
+	}
+	return backoff
+}
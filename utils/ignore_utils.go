@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sabhiram/go-gitignore"
+)
+
+// OnefileIgnoreName is the name of the per-directory file holding exclude
+// patterns that only concern onefile. It uses .gitignore syntax.
+const OnefileIgnoreName = ".onefileignore"
+
+// RepoIgnore matches paths against the ignore files git itself honours (the
+// global core.excludesFile, .git/info/exclude and every .gitignore in the
+// tree, each relative to its own directory) and against .onefileignore files.
+// Deeper files take precedence over shallower ones, a "!pattern" in a deeper
+// file re-includes what a shallower one excluded, and nothing below an ignored
+// directory can be re-included, as in git. Extra patterns, such as those given
+// with -e, are applied last and override all ignore files.
+type RepoIgnore struct {
+	// prefix is the slash-separated path of the dumped root inside the repository
+	prefix string
+	root   []ignoreSource
+	dirs   map[string][]ignoreSource
+	extra  []ignoreSource
+}
+
+type ignoreSource struct {
+	patterns *ignore.GitIgnore
+	// withBase holds the same patterns after a match-all rule, so that a path it
+	// does not match has been explicitly re-included by a negated pattern
+	withBase *ignore.GitIgnore
+}
+
+func newIgnoreSource(lines []string) ignoreSource {
+	return ignoreSource{
+		patterns: ignore.CompileIgnoreLines(lines...),
+		withBase: ignore.CompileIgnoreLines(append([]string{"*"}, lines...)...),
+	}
+}
+
+// NewRepoIgnore discovers the ignore files that apply to the project at
+// rootPath, including those in parent directories up to the repository root,
+// and combines them with extraPatterns.
+func NewRepoIgnore(rootPath string, extraPatterns []string) (*RepoIgnore, error) {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RepoIgnore{dirs: make(map[string][]ignoreSource)}
+	if len(extraPatterns) > 0 {
+		r.extra = append(r.extra, newIgnoreSource(extraPatterns))
+	}
+
+	if repoRoot := findRepoRoot(absRoot); repoRoot != "" {
+		rel, err := filepath.Rel(repoRoot, absRoot)
+		if err != nil {
+			return nil, err
+		}
+		if rel != "." {
+			r.prefix = filepath.ToSlash(rel)
+		}
+
+		if excludesFile := globalExcludesFile(repoRoot); excludesFile != "" {
+			if err := r.addRootSource(excludesFile); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.addRootSource(filepath.Join(gitDir(repoRoot), "info", "exclude")); err != nil {
+			return nil, err
+		}
+
+		// Ignore files between the repository root and the dumped directory
+		if r.prefix != "" {
+			parts := strings.Split(r.prefix, "/")
+			for i := 0; i < len(parts); i++ {
+				dir := strings.Join(parts[:i], "/")
+				if err := r.loadDir(filepath.Join(repoRoot, filepath.FromSlash(dir)), dir); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	err = filepath.Walk(absRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(absRoot, path)
+		if err != nil {
+			return err
+		}
+		if relPath != "." && (info.Name() == ".git" || r.MatchesPath(relPath+"/")) {
+			// Ignore files below an ignored directory cannot change anything
+			return filepath.SkipDir
+		}
+		return r.loadDir(path, r.repoPath(filepath.ToSlash(relPath)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *RepoIgnore) addRootSource(path string) error {
+	lines, err := loadPatternsFromFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.root = append(r.root, newIgnoreSource(lines))
+	return nil
+}
+
+// loadDir reads the ignore files of the directory at path, whose
+// repository-relative path is dir.
+func (r *RepoIgnore) loadDir(path, dir string) error {
+	for _, name := range []string{".gitignore", OnefileIgnoreName} {
+		lines, err := loadPatternsFromFile(filepath.Join(path, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.dirs[dir] = append(r.dirs[dir], newIgnoreSource(lines))
+	}
+	return nil
+}
+
+// repoPath converts a path relative to the dumped root to one relative to the repository root.
+func (r *RepoIgnore) repoPath(p string) string {
+	if p == "." {
+		p = ""
+	}
+	if r.prefix == "" {
+		return p
+	}
+	if p == "" {
+		return r.prefix
+	}
+	return r.prefix + "/" + p
+}
+
+// MatchesPath reports whether the path, relative to the dumped root, is
+// ignored. Directories may be passed with a trailing slash.
+func (r *RepoIgnore) MatchesPath(p string) bool {
+	matched, _ := r.MatchesPathHow(p)
+	return matched
+}
+
+// MatchesPathHow is MatchesPath that also returns the pattern that excluded the path.
+func (r *RepoIgnore) MatchesPathHow(p string) (bool, *ignore.IgnorePattern) {
+	p = filepath.ToSlash(p)
+	isDir := strings.HasSuffix(p, "/")
+	parts := strings.Split(strings.TrimSuffix(p, "/"), "/")
+
+	// Nothing below an ignored directory can be re-included
+	for i := 1; i < len(parts); i++ {
+		if ignored, how := r.evaluate(strings.Join(parts[:i], "/") + "/"); ignored {
+			return true, how
+		}
+	}
+
+	target := strings.Join(parts, "/")
+	if isDir {
+		target += "/"
+	}
+	return r.evaluate(target)
+}
+
+// evaluate applies every ignore source to a single root-relative path, from
+// the lowest precedence to the highest, and returns the last verdict.
+func (r *RepoIgnore) evaluate(target string) (bool, *ignore.IgnorePattern) {
+	ignored := false
+	var how *ignore.IgnorePattern
+	apply := func(source ignoreSource, rel string) {
+		if matched, pattern := source.patterns.MatchesPathHow(rel); matched {
+			ignored, how = true, pattern
+		} else if !source.withBase.MatchesPath(rel) {
+			ignored, how = false, nil
+		}
+	}
+
+	repoTarget := r.repoPath(target)
+	for _, source := range r.root {
+		apply(source, repoTarget)
+	}
+
+	dirs := strings.Split(strings.TrimSuffix(repoTarget, "/"), "/")
+	for i := 0; i < len(dirs); i++ {
+		dir := strings.Join(dirs[:i], "/")
+		rel := repoTarget
+		if dir != "" {
+			rel = repoTarget[len(dir)+1:]
+		}
+		for _, source := range r.dirs[dir] {
+			apply(source, rel)
+		}
+	}
+
+	for _, source := range r.extra {
+		apply(source, target)
+	}
+	return ignored, how
+}
+
+// findRepoRoot returns the closest directory at or above dir that contains a
+// .git entry, or "" if dir is not inside a git repository.
+func findRepoRoot(dir string) string {
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// gitDir returns the git directory of the repository at repoRoot, following
+// the "gitdir:" file used by worktrees and submodules.
+func gitDir(repoRoot string) string {
+	dotGit := filepath.Join(repoRoot, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil || info.IsDir() {
+		return dotGit
+	}
+	data, err := ioutil.ReadFile(dotGit)
+	if err != nil {
+		return dotGit
+	}
+	dir := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "gitdir:"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(repoRoot, dir)
+	}
+	return dir
+}
+
+// globalExcludesFile returns the file configured as core.excludesFile in the
+// user's or the repository's git configuration, falling back to git's default
+// location, without running git.
+func globalExcludesFile(repoRoot string) string {
+	home, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	var configFiles []string
+	if configHome != "" {
+		configFiles = append(configFiles, filepath.Join(configHome, "git", "config"))
+	}
+	if home != "" {
+		configFiles = append(configFiles, filepath.Join(home, ".gitconfig"))
+	}
+	configFiles = append(configFiles, filepath.Join(gitDir(repoRoot), "config"))
+
+	excludesFile := ""
+	for _, configFile := range configFiles {
+		if value := readGitConfigValue(configFile, "core", "excludesfile"); value != "" {
+			excludesFile = value
+		}
+	}
+	if excludesFile == "" && configHome != "" {
+		return filepath.Join(configHome, "git", "ignore")
+	}
+	if strings.HasPrefix(excludesFile, "~/") && home != "" {
+		excludesFile = filepath.Join(home, excludesFile[2:])
+	}
+	return excludesFile
+}
+
+// readGitConfigValue returns the last value of section.key in a git config
+// file. It understands the plain "key = value" form, which covers the settings
+// onefile needs.
+func readGitConfigValue(configFile, section, key string) string {
+	file, err := os.Open(configFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	value := ""
+	inSection := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			inSection = strings.EqualFold(name, section)
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), key) {
+			value = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		}
+	}
+	return value
+}
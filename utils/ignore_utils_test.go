@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoIgnore(t *testing.T) {
+	repoPath, err := ioutil.TempDir("", "onefile-ignore-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(repoPath)
+
+	// Keep the user's own git configuration out of the test
+	for _, key := range []string{"HOME", "XDG_CONFIG_HOME"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, repoPath)
+	}
+
+	files := map[string]string{
+		".git/info/exclude":   "*.tmp\n",
+		"git/ignore":          "*.bak\n",
+		".gitignore":          "*.log\nbuild/\n",
+		"sub/.gitignore":      "!keep.log\n/local.txt\n",
+		"sub/.onefileignore":  "secret.txt\n",
+		"sub/keep.log":        "",
+		"sub/drop.log":        "",
+		"sub/local.txt":       "",
+		"sub/deep/local.txt":  "",
+		"sub/deep/secret.txt": "",
+		"sub/deep/main.go":    "",
+		"build/keep.log":      "",
+		"notes.tmp":           "",
+		"notes.bak":           "",
+		"main.go":             "",
+	}
+	for name, content := range files {
+		path := filepath.Join(repoPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	repoIgnore, err := NewRepoIgnore(repoPath, []string{"main.go", "!sub/drop.log"})
+	if err != nil {
+		t.Fatalf("NewRepoIgnore failed: %v", err)
+	}
+	expected := map[string]bool{
+		"sub/keep.log":        false,
+		"sub/drop.log":        false,
+		"sub/local.txt":       true,
+		"sub/deep/local.txt":  false,
+		"sub/deep/secret.txt": true,
+		"sub/deep/main.go":    true,
+		"build/keep.log":      true,
+		"notes.tmp":           true,
+		"notes.bak":           true,
+		"main.go":             true,
+		".gitignore":          false,
+	}
+	for path, ignored := range expected {
+		if got := repoIgnore.MatchesPath(path); got != ignored {
+			t.Errorf("MatchesPath(%q) = %v, want %v", path, got, ignored)
+		}
+	}
+
+	// Ignore files above the dumped directory still apply, relative to their own directory
+	subIgnore, err := NewRepoIgnore(filepath.Join(repoPath, "sub"), nil)
+	if err != nil {
+		t.Fatalf("NewRepoIgnore failed: %v", err)
+	}
+	expected = map[string]bool{
+		"keep.log":       false,
+		"drop.log":       true,
+		"local.txt":      true,
+		"deep/local.txt": false,
+		"deep/main.go":   false,
+	}
+	for path, ignored := range expected {
+		if got := subIgnore.MatchesPath(path); got != ignored {
+			t.Errorf("sub: MatchesPath(%q) = %v, want %v", path, got, ignored)
+		}
+	}
+}
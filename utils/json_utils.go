@@ -1,40 +1,21 @@
 package utils
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"strings"
+	"bytes"
+	"io"
 )
 
 func SaveAsJSON(projectData ProjectData, outputPath string, includeGit, includeNonText bool) error {
-	// Filter directories
-	filteredDirs := make([]string, 0, len(projectData.Directories))
-	for _, dir := range projectData.Directories {
-		if includeGit || !strings.HasPrefix(dir, ".git") {
-			filteredDirs = append(filteredDirs, dir)
-		}
-	}
-
-	// Filter files
-	filteredFiles := make([]FileData, 0, len(projectData.Files))
-	for _, file := range projectData.Files {
-		if (includeGit || !strings.HasPrefix(file.Path, ".git/")) && (includeNonText || isTextFile(file.Path)) {
-			filteredFiles = append(filteredFiles, file)
-		}
-	}
-
-	// Create filtered project data
-	filteredProjectData := ProjectData{
-		Directories: filteredDirs,
-		Files:       filteredFiles,
-	}
-
-	// Marshal the filtered data to JSON
-	data, err := json.MarshalIndent(filteredProjectData, "", "  ")
-	if err != nil {
-		return err
+	newWriter := func(w io.Writer) ProjectWriter {
+		return NewJSONWriter(w, includeGit, includeNonText)
 	}
+	return writeProjectFile(outputPath, newWriter, func(w ProjectWriter) error {
+		return WriteProject(projectData, w)
+	})
+}
 
-	// Write the JSON data to the output file
-	return ioutil.WriteFile(outputPath, data, 0644)
+func GenerateJSON(projectData ProjectData, includeGit, includeNonText bool) ([]byte, error) {
+	var buf bytes.Buffer
+	err := WriteProject(projectData, NewJSONWriter(&buf, includeGit, includeNonText))
+	return buf.Bytes(), err
 }
@@ -4,7 +4,6 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"path/filepath"
 	"strings"
 
@@ -42,21 +41,16 @@ func getLanguageFromExtension(filename string) string {
 	return ""
 }
 
-func isTextFile(path string) bool {
-	// First, check if it's a known text file type based on extension
-	if len(getLanguagesFromFile(path)) > 0 {
-		return true
-	}
-
-	// If not determined by extension, check the content
-	content, err := ioutil.ReadFile(path)
-	if err != nil {
-		// If we can't read the file, assume it's not text
-		return false
-	}
+// isTextName reports whether path is a known text file type from its name
+// alone, without looking at its content.
+func isTextName(path string) bool {
+	return len(getLanguagesFromFile(path)) > 0
+}
 
-	mime := mimetype.Detect(content)
-	return strings.HasPrefix(mime.String(), "text/")
+// isTextData reports whether a file is text, from its name or, for unknown
+// types, from its content.
+func isTextData(path string, content []byte) bool {
+	return isTextName(path) || IsTextContent(content)
 }
 
 func IsTextContent(content []byte) bool {
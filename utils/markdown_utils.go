@@ -2,35 +2,105 @@ package utils
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 func GenerateMarkdown(projectData ProjectData, includeGit, includeNonText, showExcluded bool) string {
 	var md strings.Builder
+	// Writing to a strings.Builder cannot fail
+	_ = WriteProject(projectData, NewMarkdownWriter(&md, includeGit, includeNonText, showExcluded))
+	return md.String()
+}
+
+// generateMarkdownStructure renders the project tree and shell commands sections.
+func generateMarkdownStructure(projectData ProjectData, includeGit, includeNonText, showExcluded bool) string {
+	var md strings.Builder
 
+	tree := generateProjectTree(projectData, includeGit, includeNonText, showExcluded)
 	md.WriteString("# Project Structure\n\n")
-	md.WriteString("```\n")
-	md.WriteString(generateProjectTree(projectData, includeGit, includeNonText, showExcluded))
-	md.WriteString("```\n\n")
+	for _, field := range []struct{ name, value string }{
+		{"Source", projectData.Source},
+		{"Ref", projectData.Ref},
+		{"Commit", projectData.Commit},
+	} {
+		if field.value != "" {
+			md.WriteString(fmt.Sprintf("%s: %s\n", field.name, field.value))
+		}
+	}
+	if projectData.Source != "" || projectData.Ref != "" || projectData.Commit != "" {
+		md.WriteString("\n")
+	}
+	md.WriteString(codeFence(tree) + "\n")
+	md.WriteString(tree)
+	md.WriteString(codeFence(tree) + "\n\n")
 
+	commands := GenerateShellCommands(projectData, includeGit, includeNonText, showExcluded)
 	md.WriteString("## Shell Commands to Create Project Structure\n\n")
-	md.WriteString("```bash\n")
-	md.WriteString(GenerateShellCommands(projectData, includeGit, includeNonText, showExcluded))
-	md.WriteString("```\n\n")
+	md.WriteString(codeFence(commands) + "bash\n")
+	md.WriteString(commands)
+	md.WriteString(codeFence(commands) + "\n\n")
 
-	md.WriteString("## File Contents\n\n")
-	for _, file := range projectData.Files {
-		if file.Content != "" && (includeGit || !strings.HasPrefix(file.Path, ".git/")) && (includeNonText || isTextFile(file.Path)) {
-			language := getLanguageFromExtension(file.Path)
-			md.WriteString(fmt.Sprintf("### %s\n\n```%s\n%s\n```\n\n", file.Path, language, file.Content))
+	return md.String()
+}
+
+// diffHeading introduces the diff that follows the contents of a file.
+const diffHeading = "#### Diff"
+
+// generateMarkdownFile renders the heading and code block of a single file,
+// followed by its diff if it has one.
+// The label is appended to the heading, e.g. to number the segments of a file
+// that is split across several chunks.
+func generateMarkdownFile(file FileData, label string) string {
+	language := getLanguageFromExtension(file.Path)
+	content := file.Content
+	if file.Encoding == EncodingBase64 {
+		language = EncodingBase64
+		content = wrapLines(content, 76)
+	}
+	fence := codeFence(content)
+	md := fmt.Sprintf("### %s%s\n\n%s%s\n%s\n%s\n\n", file.Path, label, fence, language, content, fence)
+	if file.Diff != "" {
+		diffFence := codeFence(file.Diff)
+		md += fmt.Sprintf("%s\n\n%sdiff\n%s\n%s\n\n", diffHeading, diffFence, file.Diff, diffFence)
+	}
+	return md
+}
+
+// codeFence returns a backtick fence longer than the longest run of backticks
+// in content, so that code blocks inside the content cannot close it early.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
 		}
 	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
 
-	return md.String()
+// wrapLines breaks s into lines of at most width characters.
+func wrapLines(s string, width int) string {
+	var lines []string
+	for len(s) > width {
+		lines = append(lines, s[:width])
+		s = s[width:]
+	}
+	lines = append(lines, s)
+	return strings.Join(lines, "\n")
 }
 
 func generateProjectTree(projectData ProjectData, includeGit, includeNonText, showExcluded bool) string {
@@ -38,14 +108,18 @@ func generateProjectTree(projectData ProjectData, includeGit, includeNonText, sh
 	tree.WriteString(".\n")
 
 	var allPaths []string
+	symlinks := make(map[string]string)
 	for _, dir := range projectData.Directories {
 		if (includeGit || !strings.HasPrefix(dir, ".git")) && (showExcluded || dir != "") {
 			allPaths = append(allPaths, dir)
 		}
 	}
 	for _, file := range projectData.Files {
-		if (includeGit || !strings.HasPrefix(file.Path, ".git/")) && (includeNonText || isTextFile(file.Path)) && (showExcluded || file.Content != "") {
+		if isStructureFile(file, includeGit, includeNonText, showExcluded) {
 			allPaths = append(allPaths, file.Path)
+			if file.SymlinkTarget != "" {
+				symlinks[file.Path] = file.SymlinkTarget
+			}
 		}
 	}
 	sort.Strings(allPaths)
@@ -55,6 +129,9 @@ func generateProjectTree(projectData ProjectData, includeGit, includeNonText, sh
 		for j, part := range parts {
 			isLast := i == len(allPaths)-1 && j == len(parts)-1
 			prefix := strings.Repeat("│   ", j)
+			if target, ok := symlinks[path]; ok && j == len(parts)-1 {
+				part += " -> " + target
+			}
 			if isLast {
 				tree.WriteString(fmt.Sprintf("%s└── %s\n", prefix, part))
 			} else {
@@ -76,12 +153,19 @@ func GenerateShellCommands(projectData ProjectData, includeGit, includeNonText,
 	}
 
 	for _, file := range projectData.Files {
-		if (includeGit || !strings.HasPrefix(file.Path, ".git/")) && (includeNonText || isTextFile(file.Path)) && (showExcluded || file.Content != "") {
+		if isStructureFile(file, includeGit, includeNonText, showExcluded) {
 			dir := filepath.Dir(file.Path)
 			if dir != "." {
 				commands.WriteString(fmt.Sprintf("mkdir -p \"%s\"\n", dir))
 			}
+			if file.SymlinkTarget != "" {
+				commands.WriteString(fmt.Sprintf("ln -s \"%s\" \"%s\"\n", file.SymlinkTarget, file.Path))
+				continue
+			}
 			commands.WriteString(fmt.Sprintf("touch \"%s\"\n", file.Path))
+			if file.Mode&0111 != 0 {
+				commands.WriteString(fmt.Sprintf("chmod +x \"%s\"\n", file.Path))
+			}
 		}
 	}
 
@@ -89,6 +173,225 @@ func GenerateShellCommands(projectData ProjectData, includeGit, includeNonText,
 }
 
 func SaveAsMarkdown(projectData ProjectData, outputPath string, includeGit, includeNonText, showExcluded bool) error {
-	markdown := GenerateMarkdown(projectData, includeGit, includeNonText, showExcluded)
-	return ioutil.WriteFile(outputPath, []byte(markdown), 0644)
+	newWriter := func(w io.Writer) ProjectWriter {
+		return NewMarkdownWriter(w, includeGit, includeNonText, showExcluded)
+	}
+	return writeProjectFile(outputPath, newWriter, func(w ProjectWriter) error {
+		return WriteProject(projectData, w)
+	})
+}
+
+var (
+	mkdirCommand   = regexp.MustCompile(`^mkdir -p "(.*)"$`)
+	touchCommand   = regexp.MustCompile(`^touch "(.*)"$`)
+	symlinkCommand = regexp.MustCompile(`^ln -s "(.*)" "(.*)"$`)
+	chmodCommand   = regexp.MustCompile(`^chmod \+x "(.*)"$`)
+	headingLine    = regexp.MustCompile(`^#{1,4} `)
+	segmentLabel   = regexp.MustCompile(`^(.*) \(part (\d+) of \d+\)$`)
+	sourceLine     = regexp.MustCompile(`^(Source|Ref|Commit): (.+)$`)
+)
+
+// ParseMarkdown turns a document in the format produced by GenerateMarkdown back
+// into a ProjectData. Directories, empty files, symlinks and executable bits are
+// taken from the shell commands section, file contents from the "### path"
+// headings and the fenced code block that follows each of them, and diffs from
+// the "#### Diff" blocks after file contents. The segments of
+// files split by SplitMarkdown are joined again when the chunks are concatenated.
+func ParseMarkdown(markdown string) (ProjectData, error) {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+
+	directories := make(map[string]bool)
+	files := make(map[string]*FileData)
+	getFile := func(path string) *FileData {
+		if file, ok := files[path]; ok {
+			return file
+		}
+		file := &FileData{Path: path}
+		files[path] = file
+		return file
+	}
+
+	var projectData ProjectData
+	var section, filePath, lastPath, diffPath string
+	var segment int
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := sourceLine.FindStringSubmatch(line); m != nil && section == "" {
+			switch m[1] {
+			case "Source":
+				projectData.Source = m[2]
+			case "Ref":
+				projectData.Ref = m[2]
+			case "Commit":
+				projectData.Commit = m[2]
+			}
+			continue
+		}
+
+		if line == diffHeading {
+			diffPath = lastPath
+			continue
+		}
+
+		if strings.HasPrefix(line, "## ") {
+			section = strings.TrimSpace(line[3:])
+			filePath = ""
+			continue
+		}
+		if strings.HasPrefix(line, "### ") {
+			filePath = strings.TrimSpace(line[4:])
+			segment = 0
+			if m := segmentLabel.FindStringSubmatch(filePath); m != nil {
+				filePath = m[1]
+				segment, _ = strconv.Atoi(m[2])
+			}
+			filePath = strings.Trim(filePath, "`")
+			diffPath = ""
+			continue
+		}
+
+		fence, info, ok := parseFence(line)
+		if !ok {
+			continue
+		}
+
+		if filePath == "" {
+			block, end := readFencedBlock(lines, i+1, fence, false)
+			i = end
+			if diffPath != "" {
+				getFile(diffPath).Diff = strings.Join(block, "\n")
+				diffPath = ""
+			} else if strings.HasPrefix(section, "Shell Commands") {
+				parseShellCommands(block, directories, getFile)
+			}
+			continue
+		}
+
+		block, end := readFencedBlock(lines, i+1, fence, true)
+		if end == len(lines) {
+			return ProjectData{}, fmt.Errorf("unterminated code block for file %s", filePath)
+		}
+		i = end
+
+		file := getFile(filePath)
+		content := strings.Join(block, "\n")
+		if info == EncodingBase64 {
+			content = strings.Join(strings.Fields(content), "")
+		}
+		if segment > 1 {
+			// Later segments of a file split across chunks continue its content
+			content = file.Content + content
+		}
+		file.Content = content
+		if info == EncodingBase64 {
+			file.Encoding = EncodingBase64
+			if _, err := file.DecodedContent(); err != nil {
+				return ProjectData{}, fmt.Errorf("invalid base64 content for file %s: %v", filePath, err)
+			}
+		}
+		lastPath, filePath = filePath, ""
+	}
+
+	for path, file := range files {
+		for dir := filepath.Dir(path); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			directories[dir] = true
+		}
+		projectData.Files = append(projectData.Files, *file)
+	}
+	for dir := range directories {
+		projectData.Directories = append(projectData.Directories, dir)
+	}
+
+	sort.Strings(projectData.Directories)
+	sort.Slice(projectData.Files, func(i, j int) bool {
+		return projectData.Files[i].Path < projectData.Files[j].Path
+	})
+
+	return projectData, nil
+}
+
+func parseShellCommands(lines []string, directories map[string]bool, getFile func(string) *FileData) {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if m := mkdirCommand.FindStringSubmatch(line); m != nil {
+			directories[m[1]] = true
+		} else if m := touchCommand.FindStringSubmatch(line); m != nil {
+			getFile(m[1])
+		} else if m := symlinkCommand.FindStringSubmatch(line); m != nil {
+			getFile(m[2]).SymlinkTarget = m[1]
+		} else if m := chmodCommand.FindStringSubmatch(line); m != nil {
+			getFile(m[1]).Mode = 0755
+		}
+	}
+}
+
+// parseFence reports whether line opens a fenced code block and returns the
+// fence and the info string (the language) that follows it.
+func parseFence(line string) (fence string, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == c {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info = strings.TrimSpace(trimmed[n:])
+	if c == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], info, true
+}
+
+// isClosingFence reports whether line closes a code block opened with fence.
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) < len(fence) || len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// readFencedBlock collects the lines of a code block starting at start and
+// returns them with the index of the closing fence. GenerateMarkdown picks
+// fences with codeFence, so a fence longer than three characters always ends
+// at its first closing fence. Hand-written and LLM-produced documents often nest
+// ``` blocks inside ``` blocks, so when nested is set a three-character fence
+// only closes the block if it is followed by a heading or the end of the
+// document; if no fence qualifies the first candidate is used.
+func readFencedBlock(lines []string, start int, fence string, nested bool) ([]string, int) {
+	firstCandidate := -1
+	for i := start; i < len(lines); i++ {
+		if !isClosingFence(lines[i], fence) {
+			continue
+		}
+		if !nested || len(fence) > 3 || followedByHeading(lines, i+1) {
+			return lines[start:i], i
+		}
+		if firstCandidate < 0 {
+			firstCandidate = i
+		}
+	}
+	if firstCandidate >= 0 {
+		return lines[start:firstCandidate], firstCandidate
+	}
+	return lines[start:], len(lines)
+}
+
+func followedByHeading(lines []string, next int) bool {
+	for ; next < len(lines); next++ {
+		if strings.TrimSpace(lines[next]) == "" {
+			continue
+		}
+		return headingLine.MatchString(lines[next])
+	}
+	return true
 }
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdownRoundTrip(t *testing.T) {
+	projectData := ProjectData{
+		Directories: []string{"cmd", "docs"},
+		Files: []FileData{
+			{Path: "build.sh", Content: "#!/bin/sh\ngo build ./...\n", Mode: 0755},
+			{Path: "cmd/main.go", Content: "package main\n\nfunc main() {}\n"},
+			{Path: "docs/guide.md", Content: "# Guide\n\n```bash\nonefile dump\n```\n\nMore text.\n"},
+			{Path: "docs/usage.md", Content: "```bash\nonefile dump\n```\n\n## Usage\n\n````\nnested\n````\n"},
+			{Path: "link", SymlinkTarget: "build.sh"},
+		},
+	}
+
+	markdown := GenerateMarkdown(projectData, false, true, false)
+	if !strings.Contains(markdown, "`````Markdown\n```bash") {
+		t.Errorf("docs/usage.md was not wrapped in a fence longer than its content's backtick runs")
+	}
+
+	parsed, err := ParseMarkdown(markdown)
+	if err != nil {
+		t.Fatalf("ParseMarkdown failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed.Directories, projectData.Directories) {
+		t.Errorf("Directories = %v; want %v", parsed.Directories, projectData.Directories)
+	}
+	if !reflect.DeepEqual(parsed.Files, projectData.Files) {
+		t.Errorf("Files = %+v; want %+v", parsed.Files, projectData.Files)
+	}
+}
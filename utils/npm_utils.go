@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sabhiram/go-gitignore"
+)
+
+// DefaultNPMRegistry is the URL of the public npm registry.
+const DefaultNPMRegistry = "https://registry.npmjs.org"
+
+// npmPackument is the abbreviated package metadata the registry serves for
+// installers: the dist-tags and the tarball of every version.
+type npmPackument struct {
+	DistTags map[string]string `json:"dist-tags"`
+	Versions map[string]struct {
+		Dist struct {
+			Tarball string `json:"tarball"`
+		} `json:"dist"`
+	} `json:"versions"`
+}
+
+// FetchNPMPackage downloads a version of an npm package from the registry at
+// registryURL, or from registry.npmjs.org if it is empty. version is an exact
+// version or a dist-tag such as "next", and defaults to "latest". The leading
+// package/ directory of the tarball is stripped, and the tarball URL and the
+// resolved version are recorded as the source and ref of the result.
+func FetchNPMPackage(registryURL, packageName, version string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	if registryURL == "" {
+		registryURL = DefaultNPMRegistry
+	}
+	if version == "" {
+		version = "latest"
+	}
+	client := newAPIClient("npm registry", registryURL, false)
+
+	// Scoped packages keep their @ but have the slash escaped
+	resp, err := client.get(client.baseURL+"/"+url.PathEscape(packageName), "Accept", "application/vnd.npm.install-v1+json")
+	if err != nil {
+		return ProjectData{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ProjectData{}, fmt.Errorf("package %s not found in %s", packageName, registryURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ProjectData{}, client.statusError(resp)
+	}
+
+	var packument npmPackument
+	if err := json.NewDecoder(resp.Body).Decode(&packument); err != nil {
+		return ProjectData{}, err
+	}
+
+	resolved := version
+	if tagged, ok := packument.DistTags[version]; ok {
+		resolved = tagged
+	}
+	release, ok := packument.Versions[resolved]
+	if !ok {
+		return ProjectData{}, fmt.Errorf("version or dist-tag %q of %s not found", version, packageName)
+	}
+	if release.Dist.Tarball == "" {
+		return ProjectData{}, fmt.Errorf("no tarball found for %s@%s", packageName, resolved)
+	}
+
+	// Tarballs hold a single directory, package/ for almost all packages
+	projectData, err := downloadTarball(release.Dist.Tarball, "", client, gitIgnore, includeGit, includeNonText)
+	if err != nil {
+		return ProjectData{}, err
+	}
+	projectData.Source = release.Dist.Tarball
+	projectData.Ref = resolved
+
+	return projectData, nil
+}
+
+// ParseNPMSpec splits a package spec such as react@18.2.0 or
+// @types/node@latest into the package name and the version or dist-tag, which
+// is empty if the spec has none.
+func ParseNPMSpec(spec string) (string, string) {
+	// The @ of a scope is not a version separator
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
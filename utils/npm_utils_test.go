@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNPMSpec(t *testing.T) {
+	testCases := []struct {
+		spec, name, version string
+	}{
+		{"react", "react", ""},
+		{"react@18.2.0", "react", "18.2.0"},
+		{"@types/node", "@types/node", ""},
+		{"@types/node@next", "@types/node", "next"},
+	}
+	for _, tc := range testCases {
+		if name, version := ParseNPMSpec(tc.spec); name != tc.name || version != tc.version {
+			t.Errorf("ParseNPMSpec(%q) = %q, %q, want %q, %q", tc.spec, name, version, tc.name, tc.version)
+		}
+	}
+}
+
+func TestFetchNPMPackage(t *testing.T) {
+	tarballs := map[string][]byte{
+		"1.0.0":        tarGz(t, "package/", map[string]string{"package.json": `{"version": "1.0.0"}`, "index.js": "module.exports = 1\n"}),
+		"2.0.0-beta.1": tarGz(t, "package/", map[string]string{"package.json": `{"version": "2.0.0-beta.1"}`, "lib/index.js": "module.exports = 2\n"}),
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.EscapedPath(); {
+		case path == "/@scope%2Fpkg":
+			if r.Header.Get("Accept") != "application/vnd.npm.install-v1+json" {
+				t.Errorf("Unexpected Accept header %q", r.Header.Get("Accept"))
+			}
+			fmt.Fprintf(w, `{
+				"name": "@scope/pkg",
+				"dist-tags": {"latest": "1.0.0", "next": "2.0.0-beta.1"},
+				"versions": {
+					"1.0.0": {"dist": {"tarball": "%[1]s/tarballs/1.0.0.tgz"}},
+					"2.0.0-beta.1": {"dist": {"tarball": "%[1]s/tarballs/2.0.0-beta.1.tgz"}}
+				}
+			}`, server.URL)
+		case strings.HasPrefix(path, "/tarballs/"):
+			w.Write(tarballs[strings.TrimSuffix(strings.TrimPrefix(path, "/tarballs/"), ".tgz")])
+		default:
+			http.Error(w, `{"error": "Not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		version, resolved string
+		files             []string
+	}{
+		{"", "1.0.0", []string{"index.js", "package.json"}},
+		{"next", "2.0.0-beta.1", []string{"lib/index.js", "package.json"}},
+		{"1.0.0", "1.0.0", []string{"index.js", "package.json"}},
+	}
+	for _, tc := range testCases {
+		projectData, err := FetchNPMPackage(server.URL, "@scope/pkg", tc.version, CreateGitIgnoreMatcher(nil), false, false)
+		if err != nil {
+			t.Fatalf("FetchNPMPackage(%q) failed: %v", tc.version, err)
+		}
+		if paths := getFilePaths(projectData.Files); !reflect.DeepEqual(paths, tc.files) {
+			t.Errorf("FetchNPMPackage(%q) files = %v, want %v", tc.version, paths, tc.files)
+		}
+		if projectData.Ref != tc.resolved || projectData.Source != server.URL+"/tarballs/"+tc.resolved+".tgz" {
+			t.Errorf("FetchNPMPackage(%q) recorded %q %q", tc.version, projectData.Source, projectData.Ref)
+		}
+	}
+
+	if _, err := FetchNPMPackage(server.URL, "@scope/pkg", "3.0.0", CreateGitIgnoreMatcher(nil), false, false); err == nil {
+		t.Errorf("FetchNPMPackage accepted a missing version")
+	}
+	if _, err := FetchNPMPackage(server.URL, "missing", "", CreateGitIgnoreMatcher(nil), false, false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("FetchNPMPackage of a missing package = %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PathIssue describes a project entry that cannot be written safely.
+type PathIssue struct {
+	Path   string
+	Reason string
+}
+
+// UnsafePathsError lists every unsafe entry found in a ProjectData.
+type UnsafePathsError struct {
+	Issues []PathIssue
+}
+
+func (e *UnsafePathsError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("refusing to write %d unsafe path(s):", len(e.Issues)))
+	for _, issue := range e.Issues {
+		sb.WriteString(fmt.Sprintf("\n  %q: %s", issue.Path, issue.Reason))
+	}
+	return sb.String()
+}
+
+// ValidateRelativePath checks that p is a relative path that stays inside the
+// directory it is joined to. Backslashes are treated as separators so that
+// paths produced on Windows are checked the same way.
+func ValidateRelativePath(p string) error {
+	if p == "" {
+		return fmt.Errorf("path is empty")
+	}
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(p) || hasDriveLetter(slashed) {
+		return fmt.Errorf("path is absolute")
+	}
+	cleaned := path.Clean(slashed)
+	if cleaned == "." {
+		return fmt.Errorf("path refers to the output directory itself")
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("path escapes the output directory")
+	}
+	return nil
+}
+
+func hasDriveLetter(p string) bool {
+	if len(p) < 2 || p[1] != ':' {
+		return false
+	}
+	c := p[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// cleanRelativePath normalizes a path that passed ValidateRelativePath.
+func cleanRelativePath(p string) string {
+	return path.Clean(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// ValidateProjectPaths checks that reconstructing projectData into outputPath
+// only writes inside outputPath. It rejects absolute and escaping paths,
+// duplicate entries, symlinks pointing outside the project and entries that
+// would be written through a symlink, whether that symlink is part of the
+// project or already exists under outputPath.
+func ValidateProjectPaths(projectData ProjectData, outputPath string) error {
+	var issues []PathIssue
+	addIssue := func(p string, format string, args ...interface{}) {
+		issues = append(issues, PathIssue{Path: p, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	dirs := make(map[string]bool)
+	for _, dir := range projectData.Directories {
+		if err := ValidateRelativePath(dir); err != nil {
+			addIssue(dir, "%v", err)
+			continue
+		}
+		dirs[cleanRelativePath(dir)] = true
+	}
+
+	files := make(map[string]bool)
+	symlinks := make(map[string]bool)
+	for _, file := range projectData.Files {
+		if err := ValidateRelativePath(file.Path); err != nil {
+			addIssue(file.Path, "%v", err)
+			continue
+		}
+		cleaned := cleanRelativePath(file.Path)
+		if files[cleaned] {
+			addIssue(file.Path, "duplicate entry")
+			continue
+		}
+		if dirs[cleaned] {
+			addIssue(file.Path, "conflicts with a directory of the same name")
+			continue
+		}
+		files[cleaned] = true
+
+		if file.SymlinkTarget != "" {
+			symlinks[cleaned] = true
+			target := strings.ReplaceAll(file.SymlinkTarget, `\`, "/")
+			resolved := path.Join(path.Dir(cleaned), target)
+			if strings.HasPrefix(target, "/") || hasDriveLetter(target) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+				addIssue(file.Path, "symlink target %q points outside the project", file.SymlinkTarget)
+			}
+		}
+	}
+
+	checkParents := func(p string) {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				addIssue(p, "would be written through symlink %q", dir)
+				return
+			}
+			info, err := os.Lstat(filepath.Join(outputPath, filepath.FromSlash(dir)))
+			if err == nil && info.Mode()&os.ModeSymlink != 0 {
+				addIssue(p, "would be written through existing symlink %q", filepath.Join(outputPath, dir))
+				return
+			}
+		}
+	}
+	for dir := range dirs {
+		checkParents(dir)
+	}
+	for file := range files {
+		checkParents(file)
+	}
+
+	if len(issues) > 0 {
+		sort.Slice(issues, func(i, j int) bool {
+			if issues[i].Path != issues[j].Path {
+				return issues[i].Path < issues[j].Path
+			}
+			return issues[i].Reason < issues[j].Reason
+		})
+		return &UnsafePathsError{Issues: issues}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestValidateProjectPaths(t *testing.T) {
+	testCases := []struct {
+		name    string
+		project ProjectData
+		valid   bool
+	}{
+		{"plain", ProjectData{Directories: []string{"src"}, Files: []FileData{{Path: "src/main.go"}}}, true},
+		{"parent traversal", ProjectData{Files: []FileData{{Path: "../../.bashrc"}}}, false},
+		{"hidden traversal", ProjectData{Files: []FileData{{Path: "src/../../x"}}}, false},
+		{"absolute", ProjectData{Files: []FileData{{Path: "/etc/passwd"}}}, false},
+		{"windows absolute", ProjectData{Files: []FileData{{Path: `C:\Windows\x`}}}, false},
+		{"duplicate", ProjectData{Files: []FileData{{Path: "a.txt"}, {Path: "./a.txt"}}}, false},
+		{"symlink escape", ProjectData{Files: []FileData{{Path: "link", SymlinkTarget: "../outside"}}}, false},
+		{"symlink inside", ProjectData{Files: []FileData{{Path: "bin/run", SymlinkTarget: "../build.sh"}}}, true},
+		{"write through symlink", ProjectData{Files: []FileData{{Path: "lib", SymlinkTarget: "src"}, {Path: "lib/x.go"}}}, false},
+	}
+
+	for _, tc := range testCases {
+		err := ValidateProjectPaths(tc.project, "does-not-exist")
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateProjectPaths() error = %v; want valid = %v", tc.name, err, tc.valid)
+		}
+	}
+}
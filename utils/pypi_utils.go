@@ -6,7 +6,6 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
-	"github.com/gabriel-vasile/mimetype"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -16,7 +15,7 @@ import (
 	"github.com/sabhiram/go-gitignore"
 )
 
-func FetchPyPIPackage(packageName string, gitIgnore *ignore.GitIgnore, includeGit, includeNonText bool) (ProjectData, error) {
+func FetchPyPIPackage(packageName string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
 	var projectData ProjectData
 
 	url := fmt.Sprintf("https://pypi.org/pypi/%s/json", packageName)
@@ -88,7 +87,7 @@ func FetchPyPIPackage(packageName string, gitIgnore *ignore.GitIgnore, includeGi
 	}
 
 	if strings.HasSuffix(packageURL, ".tar.gz") {
-		return extractTarGz(tmpFile, gitIgnore, includeGit, includeNonText)
+		return extractTarGz(tmpFile, 0, "", gitIgnore, includeGit, includeNonText)
 	} else if strings.HasSuffix(packageURL, ".whl") {
 		return extractWheel(tmpFile, gitIgnore, includeGit, includeNonText)
 	} else {
@@ -96,10 +95,13 @@ func FetchPyPIPackage(packageName string, gitIgnore *ignore.GitIgnore, includeGi
 	}
 }
 
-func extractTarGz(file *os.File, gitIgnore *ignore.GitIgnore, includeGit, includeNonText bool) (ProjectData, error) {
+// extractTarGz reads a gzipped tar archive. The first stripComponents path
+// components of every entry are removed and, if subdir is set, only the
+// entries below subdir are kept, relative to it.
+func extractTarGz(r io.Reader, stripComponents int, subdir string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
 	var projectData ProjectData
 
-	gzr, err := gzip.NewReader(file)
+	gzr, err := gzip.NewReader(r)
 	if err != nil {
 		return projectData, err
 	}
@@ -116,31 +118,62 @@ func extractTarGz(file *os.File, gitIgnore *ignore.GitIgnore, includeGit, includ
 			return projectData, err
 		}
 
-		if !MatchesPatterns(header.Name, gitIgnore, includeGit, includeNonText) {
+		name, ok := archiveEntryPath(header.Name, stripComponents, subdir)
+		if !ok || ValidateRelativePath(name) != nil {
+			// Never let archive entries escape the project root
 			continue
 		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
-			projectData.Directories = append(projectData.Directories, header.Name)
+			if matchesPathPatterns(name+"/", gitIgnore, includeGit) {
+				projectData.Directories = append(projectData.Directories, name)
+			}
+		case tar.TypeSymlink:
+			if matchesPathPatterns(name, gitIgnore, includeGit) {
+				fileData := newFileData(name, header.FileInfo())
+				fileData.SymlinkTarget = header.Linkname
+				projectData.Files = append(projectData.Files, fileData)
+			}
 		case tar.TypeReg:
+			// Whether a file is text is decided from its content once read
+			if !matchesPathPatterns(name, gitIgnore, includeGit) {
+				continue
+			}
 			content, err := ioutil.ReadAll(tr)
 			if err != nil {
 				return projectData, err
 			}
-			if IsTextContent(content) || includeNonText {
-				projectData.Files = append(projectData.Files, FileData{Path: header.Name, Content: string(content)})
-			} else {
-				mime := mimetype.Detect(content)
-				projectData.Files = append(projectData.Files, FileData{Path: header.Name, Content: fmt.Sprintf("[Binary file: %s]", mime.String())})
-			}
+			fileData := newFileData(name, header.FileInfo())
+			fileData.setFileContent(content, includeNonText)
+			projectData.Files = append(projectData.Files, fileData)
 		}
 	}
 
 	return projectData, nil
 }
 
-func extractWheel(file *os.File, gitIgnore *ignore.GitIgnore, includeGit, includeNonText bool) (ProjectData, error) {
+// archiveEntryPath applies stripComponents and subdir (see extractTarGz) to
+// the name of an archive entry. Directory names lose their trailing slash.
+func archiveEntryPath(name string, stripComponents int, subdir string) (string, bool) {
+	name = strings.TrimSuffix(name, "/")
+	for i := 0; i < stripComponents; i++ {
+		slash := strings.Index(name, "/")
+		if slash < 0 {
+			return "", false
+		}
+		name = name[slash+1:]
+	}
+	if subdir = strings.Trim(subdir, "/"); subdir != "" {
+		if !strings.HasPrefix(name, subdir+"/") {
+			return "", false
+		}
+		name = name[len(subdir)+1:]
+	}
+	return name, name != ""
+}
+
+func extractWheel(file *os.File, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
 	var projectData ProjectData
 
 	fileInfo, err := file.Stat()
@@ -153,30 +186,53 @@ func extractWheel(file *os.File, gitIgnore *ignore.GitIgnore, includeGit, includ
 		return projectData, err
 	}
 
+	return extractZip(r, "", gitIgnore, includeGit, includeNonText)
+}
+
+// extractZip reads the entries of a zip archive whose names start with prefix,
+// such as the module@version/ directory of Go module zips, with prefix removed.
+func extractZip(r *zip.Reader, prefix string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) (ProjectData, error) {
+	var projectData ProjectData
+
 	for _, f := range r.File {
-		if !MatchesPatterns(f.Name, gitIgnore, includeGit, includeNonText) {
+		if !strings.HasPrefix(f.Name, prefix) {
+			continue
+		}
+		name := f.Name[len(prefix):]
+		if name == "" || ValidateRelativePath(name) != nil {
 			continue
 		}
 
 		if f.FileInfo().IsDir() {
-			projectData.Directories = append(projectData.Directories, f.Name)
-		} else {
-			rc, err := f.Open()
-			if err != nil {
-				return projectData, err
-			}
-			content, err := ioutil.ReadAll(rc)
-			rc.Close()
-			if err != nil {
-				return projectData, err
-			}
-			if IsTextContent(content) || includeNonText {
-				projectData.Files = append(projectData.Files, FileData{Path: f.Name, Content: string(content)})
-			} else {
-				mime := mimetype.Detect(content)
-				projectData.Files = append(projectData.Files, FileData{Path: f.Name, Content: fmt.Sprintf("[Binary file: %s]", mime.String())})
+			if matchesPathPatterns(name, gitIgnore, includeGit) {
+				projectData.Directories = append(projectData.Directories, strings.TrimSuffix(name, "/"))
 			}
+			continue
+		}
+
+		if !matchesPathPatterns(name, gitIgnore, includeGit) {
+			continue
+		}
+		isSymlink := f.Mode()&os.ModeSymlink != 0
+
+		rc, err := f.Open()
+		if err != nil {
+			return projectData, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return projectData, err
+		}
+
+		fileData := newFileData(name, f.FileInfo())
+		if isSymlink {
+			// Zip archives store the link target as the entry's content
+			fileData.SymlinkTarget = string(content)
+		} else {
+			fileData.setFileContent(content, includeNonText)
 		}
+		projectData.Files = append(projectData.Files, fileData)
 	}
 
 	return projectData, nil
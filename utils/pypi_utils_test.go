@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// archiveFiles has extension-less text files below the root, whose type can
+// only be told from their content, and a binary file.
+var archiveFiles = map[string]string{
+	"pkg/sub/LICENSE":  "MIT License\n\nPermission is hereby granted, free of charge.\n",
+	"pkg/sub/Makefile": "all:\n\tgo build ./...\n",
+	"pkg/main.go":      "package main\n",
+	"pkg/logo":         "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01",
+}
+
+// checkArchiveFiles checks that the text files of archiveFiles were kept with
+// their contents and the binary one was left out of the output.
+func checkArchiveFiles(t *testing.T, method string, projectData ProjectData) {
+	var text []string
+	for _, file := range projectData.Files {
+		if !isOutputFile(file, false, false) {
+			continue
+		}
+		text = append(text, file.Path)
+		if file.Content != archiveFiles[file.Path] {
+			t.Errorf("%s: %s has content %q", method, file.Path, file.Content)
+		}
+	}
+	expected := []string{"pkg/main.go", "pkg/sub/LICENSE", "pkg/sub/Makefile"}
+	if !reflect.DeepEqual(text, expected) {
+		t.Errorf("%s: text files = %v, want %v", method, text, expected)
+	}
+}
+
+func TestExtractArchivesDetectsText(t *testing.T) {
+	projectData, err := extractTarGz(bytes.NewReader(tarGz(t, "top/", archiveFiles)), 1, "", CreateGitIgnoreMatcher(nil), false, false)
+	if err != nil {
+		t.Fatalf("extractTarGz failed: %v", err)
+	}
+	checkArchiveFiles(t, "extractTarGz", projectData)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"pkg/logo", "pkg/main.go", "pkg/sub/LICENSE", "pkg/sub/Makefile"} {
+		w, err := zw.Create("top/" + name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		w.Write([]byte(archiveFiles[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	projectData, err = extractZip(r, "top/", CreateGitIgnoreMatcher(nil), false, false)
+	if err != nil {
+		t.Fatalf("extractZip failed: %v", err)
+	}
+	checkArchiveFiles(t, "extractZip", projectData)
+}
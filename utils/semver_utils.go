@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version. Build metadata is dropped, as it does
+// not take part in comparisons.
+type semver struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// parseSemver parses a MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version, with or
+// without the leading v of Go module versions.
+func parseSemver(version string) (semver, bool) {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	var v semver
+	if i := strings.Index(version, "-"); i >= 0 {
+		v.prerelease = strings.Split(version[i+1:], ".")
+		for _, identifier := range v.prerelease {
+			if identifier == "" {
+				return semver{}, false
+			}
+		}
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	numbers := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, ok := parseSemverNumber(part)
+		if !ok {
+			return semver{}, false
+		}
+		*numbers[i] = n
+	}
+	return v, true
+}
+
+// parseSemverNumber parses a numeric version component, which must not have
+// leading zeros.
+func parseSemverNumber(s string) (int, bool) {
+	if s == "" || len(s) > 1 && s[0] == '0' {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= 0
+}
+
+// compareSemver compares two versions by semantic versioning precedence and
+// returns -1, 0 or 1. Invalid versions sort before all valid ones.
+func compareSemver(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	for _, d := range []int{va.major - vb.major, va.minor - vb.minor, va.patch - vb.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	// A prerelease comes before its release
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0
+	case len(va.prerelease) == 0:
+		return 1
+	case len(vb.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return sign(len(va.prerelease) - len(vb.prerelease))
+}
+
+// comparePrerelease compares prerelease identifiers: numeric ones numerically
+// and before alphanumeric ones, which compare as strings.
+func comparePrerelease(a, b string) int {
+	na, numericA := parseSemverNumber(a)
+	nb, numericB := parseSemverNumber(b)
+	switch {
+	case numericA && numericB:
+		return sign(na - nb)
+	case numericA:
+		return -1
+	case numericB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// isPrerelease reports whether version is a valid prerelease version.
+func isPrerelease(version string) bool {
+	v, ok := parseSemver(version)
+	return ok && len(v.prerelease) > 0
+}
+
+// latestSemver returns the highest release among versions, or the highest
+// prerelease if there is no release, skipping invalid versions. It returns ""
+// if there is no valid version.
+func latestSemver(versions []string) string {
+	var latest string
+	for _, version := range versions {
+		if _, ok := parseSemver(version); !ok {
+			continue
+		}
+		if latest == "" || isPrerelease(latest) && !isPrerelease(version) ||
+			isPrerelease(latest) == isPrerelease(version) && compareSemver(version, latest) > 0 {
+			latest = version
+		}
+	}
+	return latest
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sabhiram/go-gitignore"
+)
+
+// ProjectWriter encodes a project while it is being read. WriteHeader receives
+// the structure of the project, every directory and file entry without file
+// contents, and is followed by one WriteFile call per file entry, in the same
+// order, carrying its contents. Close finishes the document; it does not close
+// the underlying io.Writer.
+type ProjectWriter interface {
+	WriteHeader(structure ProjectData) error
+	WriteFile(file FileData) error
+	Close() error
+}
+
+// WriteProject writes an in-memory project to w.
+func WriteProject(projectData ProjectData, w ProjectWriter) error {
+	if err := w.WriteHeader(projectData); err != nil {
+		return err
+	}
+	for _, file := range projectData.Files {
+		if err := w.WriteFile(file); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// StreamProject walks rootPath like DumpProject but hands every file to w as
+// soon as it has been read instead of collecting the whole project in memory,
+// so memory use stays bounded by jobs times the size of the largest file.
+func StreamProject(rootPath string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool, jobs int, w ProjectWriter) error {
+	return streamProject(rootPath, filepath.Walk, gitIgnore, includeGit, includeNonText, jobs, w)
+}
+
+// StreamProjectFiles is StreamProject for the given files, relative to
+// rootPath, as with DumpProjectFiles.
+func StreamProjectFiles(rootPath string, paths []string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool, jobs int, w ProjectWriter) error {
+	return streamProject(rootPath, walkFileList(paths), gitIgnore, includeGit, includeNonText, jobs, w)
+}
+
+func streamProject(rootPath string, walk walkFunc, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool, jobs int, w ProjectWriter) error {
+	structure, err := walkProject(rootPath, walk, gitIgnore, includeGit)
+	if err != nil {
+		return err
+	}
+
+	if err := w.WriteHeader(structure); err != nil {
+		return err
+	}
+
+	err = readProjectFiles(rootPath, structure.Files, includeNonText, jobs, w.WriteFile)
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+type jsonProjectWriter struct {
+	w                          io.Writer
+	includeGit, includeNonText bool
+	files                      int
+}
+
+// NewJSONWriter returns a ProjectWriter producing the same document as SaveAsJSON.
+func NewJSONWriter(w io.Writer, includeGit, includeNonText bool) ProjectWriter {
+	return &jsonProjectWriter{w: w, includeGit: includeGit, includeNonText: includeNonText}
+}
+
+func (jw *jsonProjectWriter) WriteHeader(structure ProjectData) error {
+	// Filter directories
+	filteredDirs := make([]string, 0, len(structure.Directories))
+	for _, dir := range structure.Directories {
+		if jw.includeGit || !strings.HasPrefix(dir, ".git") {
+			filteredDirs = append(filteredDirs, dir)
+		}
+	}
+
+	var header strings.Builder
+	header.WriteString("{\n")
+	if structure.Chunk != nil {
+		chunk, err := json.MarshalIndent(structure.Chunk, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&header, "  \"chunk\": %s,\n", chunk)
+	}
+	for _, field := range []struct{ name, value string }{
+		{"source", structure.Source},
+		{"ref", structure.Ref},
+		{"commit", structure.Commit},
+	} {
+		if field.value == "" {
+			continue
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&header, "  %q: %s,\n", field.name, value)
+	}
+
+	dirs, err := json.MarshalIndent(filteredDirs, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(jw.w, "%s  \"directories\": %s,\n  \"files\": [", header.String(), dirs)
+	return err
+}
+
+func (jw *jsonProjectWriter) WriteFile(file FileData) error {
+	if !isOutputFile(file, jw.includeGit, jw.includeNonText) {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(file, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := ",\n    "
+	if jw.files == 0 {
+		separator = "\n    "
+	}
+	jw.files++
+	_, err = fmt.Fprintf(jw.w, "%s%s", separator, data)
+	return err
+}
+
+func (jw *jsonProjectWriter) Close() error {
+	closing := "]\n}"
+	if jw.files > 0 {
+		closing = "\n  ]\n}"
+	}
+	_, err := io.WriteString(jw.w, closing)
+	return err
+}
+
+type markdownProjectWriter struct {
+	w                                        io.Writer
+	includeGit, includeNonText, showExcluded bool
+}
+
+// NewMarkdownWriter returns a ProjectWriter producing the same document as SaveAsMarkdown.
+func NewMarkdownWriter(w io.Writer, includeGit, includeNonText, showExcluded bool) ProjectWriter {
+	return &markdownProjectWriter{w: w, includeGit: includeGit, includeNonText: includeNonText, showExcluded: showExcluded}
+}
+
+func (mw *markdownProjectWriter) WriteHeader(structure ProjectData) error {
+	_, err := io.WriteString(mw.w, generateMarkdownStructure(structure, mw.includeGit, mw.includeNonText, mw.showExcluded)+"## File Contents\n\n")
+	return err
+}
+
+func (mw *markdownProjectWriter) WriteFile(file FileData) error {
+	if file.Content == "" || !isOutputFile(file, mw.includeGit, mw.includeNonText) {
+		return nil
+	}
+	_, err := io.WriteString(mw.w, generateMarkdownFile(file, ""))
+	return err
+}
+
+func (mw *markdownProjectWriter) Close() error {
+	return nil
+}
+
+// writeProjectFile creates outputPath and writes a project to it through the
+// writer returned by newWriter, using write to produce the contents.
+func writeProjectFile(outputPath string, newWriter func(io.Writer) ProjectWriter, write func(ProjectWriter) error) error {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewWriter(f)
+	err = write(newWriter(buffered))
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
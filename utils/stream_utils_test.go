@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamProjectMatchesDumpProject(t *testing.T) {
+	rootPath, err := ioutil.TempDir("", "onefile-stream-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(rootPath)
+
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"docs/guide.md":    "# Guide\n",
+		"docs/notes.txt":   "ignored\n",
+		"scripts/run.sh":   "#!/bin/sh\n",
+		"scripts/empty.sh": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(rootPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	gitIgnore := CreateGitIgnoreMatcher([]string{"*.txt"})
+
+	projectData, err := DumpProject(rootPath, gitIgnore, false, false, 4)
+	if err != nil {
+		t.Fatalf("DumpProject failed: %v", err)
+	}
+
+	for _, outputType := range []string{"json", "md"} {
+		var expected, streamed bytes.Buffer
+		var w ProjectWriter
+		if outputType == "json" {
+			data, err := GenerateJSON(projectData, false, false)
+			if err != nil {
+				t.Fatalf("GenerateJSON failed: %v", err)
+			}
+			expected.Write(data)
+			w = NewJSONWriter(&streamed, false, false)
+		} else {
+			expected.WriteString(GenerateMarkdown(projectData, false, false, false))
+			w = NewMarkdownWriter(&streamed, false, false, false)
+		}
+
+		if err := StreamProject(rootPath, gitIgnore, false, false, 4, w); err != nil {
+			t.Fatalf("StreamProject failed: %v", err)
+		}
+		if streamed.String() != expected.String() {
+			t.Errorf("Streamed %s output differs:\n%s\nwant:\n%s", outputType, streamed.String(), expected.String())
+		}
+	}
+}
+
+// writeTestProject creates a project with a nested extension-less text file
+// and a binary file, whose types can only be told from their contents.
+func writeTestProject(t *testing.T) string {
+	rootPath, err := ioutil.TempDir("", "onefile-jobs-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	files := map[string]string{
+		"main.go":       "package main\n",
+		"src/LICENSE":   "MIT License\n\nPermission is hereby granted, free of charge.\n",
+		"src/Makefile":  "all:\n\tgo build ./...\n",
+		"assets/logo":   "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01",
+		"docs/guide.md": "# Guide\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(rootPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return rootPath
+}
+
+func TestStreamProjectJobs(t *testing.T) {
+	rootPath := writeTestProject(t)
+	defer os.RemoveAll(rootPath)
+
+	// Relative file paths must not be resolved against the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(os.TempDir()); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	for _, outputType := range []string{"json", "md"} {
+		var first string
+		for _, jobs := range []int{1, 2, 8} {
+			var streamed bytes.Buffer
+			w := NewMarkdownWriter(&streamed, false, false, false)
+			if outputType == "json" {
+				w = NewJSONWriter(&streamed, false, false)
+			}
+			if err := StreamProject(rootPath, CreateGitIgnoreMatcher(nil), false, false, jobs, w); err != nil {
+				t.Fatalf("StreamProject with %d jobs failed: %v", jobs, err)
+			}
+			if jobs == 1 {
+				first = streamed.String()
+			} else if streamed.String() != first {
+				t.Errorf("%s output with %d jobs differs:\n%s\nwant:\n%s", outputType, jobs, streamed.String(), first)
+			}
+		}
+
+		for _, text := range []string{"MIT License", "go build"} {
+			if !strings.Contains(first, text) {
+				t.Errorf("%s output is missing an extension-less text file: %s", outputType, first)
+			}
+		}
+		if strings.Contains(first, "PNG") {
+			t.Errorf("%s output has the contents of a binary file", outputType)
+		}
+	}
+}
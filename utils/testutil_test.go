@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tarGz builds a gzipped tarball with the given files below prefix, in name
+// order. Names ending in a slash become directories, and headers are written
+// first as entries without content, e.g. the global header of git archive.
+func tarGz(t *testing.T, prefix string, files map[string]string, headers ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, header := range headers {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := &tar.Header{Name: prefix + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[name]))}
+		if strings.HasSuffix(prefix+name, "/") {
+			header = &tar.Header{Name: prefix + name, Typeflag: tar.TypeDir, Mode: 0755}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatalf("Failed to write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to write tarball: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("Failed to write tarball: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,382 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sabhiram/go-gitignore"
+)
+
+// Tokenizer counts the tokens a language model would see for a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc adapts an ordinary function to the Tokenizer interface.
+type TokenizerFunc func(text string) int
+
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+var tokenizers = map[string]Tokenizer{
+	"approx": TokenizerFunc(approximateTokenCount),
+	"chars": TokenizerFunc(func(text string) int {
+		return (utf8.RuneCountInString(text) + 3) / 4
+	}),
+}
+
+// RegisterTokenizer makes a tokenizer available to GetTokenizer under name.
+func RegisterTokenizer(name string, tokenizer Tokenizer) {
+	tokenizers[name] = tokenizer
+}
+
+// GetTokenizer returns the tokenizer registered under name. The built-in
+// tokenizers are "approx", an offline approximation of cl100k-style BPE, and
+// "chars", which assumes four characters per token.
+func GetTokenizer(name string) (Tokenizer, error) {
+	tokenizer, ok := tokenizers[name]
+	if !ok {
+		var names []string
+		for n := range tokenizers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown tokenizer %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return tokenizer, nil
+}
+
+var contractions = []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"}
+
+// approximateTokenCount splits text the way the cl100k pre-tokenizer does
+// (words with their leading space, numbers of up to three digits, punctuation
+// runs, whitespace runs) and estimates how many BPE tokens each piece becomes.
+// It is usually within 10-15% of the real count for source code and prose.
+func approximateTokenCount(text string) int {
+	runes := []rune(text)
+	count := 0
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		if r == '\'' {
+			if n := contractionLength(runes[i:]); n > 0 {
+				count++
+				i += n
+				continue
+			}
+		}
+
+		start := i
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\n' && r != '\r' && i+1 < len(runes) && unicode.IsLetter(runes[i+1]) {
+			// A single leading space or symbol is merged into the following word
+			i++
+		}
+		if unicode.IsLetter(runes[i]) {
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			count += wordTokens(runes[start:i])
+			continue
+		}
+		i = start
+
+		switch {
+		case unicode.IsDigit(r):
+			for n := 0; i < len(runes) && unicode.IsDigit(runes[i]) && n < 3; n++ {
+				i++
+			}
+			count++
+		case unicode.IsSpace(r):
+			hasNewline := false
+			for i < len(runes) && unicode.IsSpace(runes[i]) {
+				if runes[i] == '\n' || runes[i] == '\r' {
+					hasNewline = true
+				}
+				i++
+			}
+			if i-start == 1 && r == ' ' && i < len(runes) {
+				// A lone space belongs to the piece that follows it
+				continue
+			}
+			if hasNewline && runes[i-1] != '\n' && runes[i-1] != '\r' {
+				// Indentation after a line break is a separate piece
+				count++
+			}
+			count++
+		default:
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+				i++
+			}
+			count += (i - start + 1) / 2
+		}
+	}
+	return count
+}
+
+func contractionLength(runes []rune) int {
+	for _, c := range contractions {
+		n := utf8.RuneCountInString(c)
+		if len(runes) >= n && strings.EqualFold(string(runes[:n]), c) {
+			if len(runes) == n || !unicode.IsLetter(runes[n]) {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// wordTokens estimates the tokens of a word: one per camelCase segment plus one
+// per further ten letters, and roughly one per character for non-Latin scripts.
+func wordTokens(word []rune) int {
+	tokens := 0
+	segment := 0
+	for i, r := range word {
+		if r > unicode.MaxLatin1 {
+			tokens++
+			segment = 0
+			continue
+		}
+		if segment > 0 && unicode.IsUpper(r) && i > 0 && unicode.IsLower(word[i-1]) {
+			tokens += 1 + (segment-1)/10
+			segment = 0
+		}
+		segment++
+	}
+	if segment > 0 {
+		tokens += 1 + (segment-1)/10
+	}
+	return tokens
+}
+
+// PriorityRule assigns a priority to every path matching Pattern. Files with a
+// higher priority are kept first when a dump has to fit a token budget.
+type PriorityRule struct {
+	Pattern  string
+	Priority int
+	matcher  *ignore.GitIgnore
+}
+
+// DefaultPriorityRules favour documentation and manifests and give up tests,
+// lock files and minified assets first.
+var DefaultPriorityRules = []string{
+	"README*=100",
+	"go.mod=90",
+	"package.json=90",
+	"Cargo.toml=90",
+	"pyproject.toml=90",
+	"setup.py=90",
+	"*_test.go=-10",
+	"test/=-10",
+	"tests/=-10",
+	"go.sum=-50",
+	"package-lock.json=-50",
+	"yarn.lock=-50",
+	"Cargo.lock=-50",
+	"poetry.lock=-50",
+	"*.min.js=-50",
+}
+
+// ParsePriorityRules parses rules of the form "pattern=priority", where pattern
+// uses .gitignore syntax. When several rules match a path the last one wins.
+func ParsePriorityRules(specs []string) ([]PriorityRule, error) {
+	var rules []PriorityRule
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid priority rule %q, expected pattern=priority", spec)
+		}
+		priority, err := strconv.Atoi(spec[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority in rule %q: %v", spec, err)
+		}
+		pattern := spec[:i]
+		rules = append(rules, PriorityRule{Pattern: pattern, Priority: priority, matcher: ignore.CompileIgnoreLines(pattern)})
+	}
+	return rules, nil
+}
+
+func filePriority(path string, rules []PriorityRule) int {
+	priority := 0
+	for _, rule := range rules {
+		if rule.matcher.MatchesPath(path) {
+			priority = rule.Priority
+		}
+	}
+	return priority
+}
+
+// BudgetReport describes what FitToTokenBudget removed to meet the budget.
+type BudgetReport struct {
+	MaxTokens  int
+	UsedTokens int
+	Dropped    []string
+	Truncated  []string
+}
+
+// FitToTokenBudget keeps file contents in priority order while render(projectData)
+// stays within maxTokens tokens and drops the files that no longer fit. With
+// truncate set, a file that does not fit is cut short to fill the remaining
+// budget instead of being dropped. Dropped files are removed from the result
+// and only listed in the report. Each file is measured once on its own and the
+// whole project is only rendered again to confirm the total.
+func FitToTokenBudget(projectData ProjectData, maxTokens int, tokenizer Tokenizer, rules []PriorityRule, truncate bool, render func(ProjectData) (string, error)) (ProjectData, BudgetReport, error) {
+	report := BudgetReport{MaxTokens: maxTokens}
+	measure := func(data ProjectData) (int, error) {
+		output, err := render(data)
+		if err != nil {
+			return 0, err
+		}
+		return tokenizer.CountTokens(output), nil
+	}
+
+	result := projectData
+	result.Files = make([]FileData, len(projectData.Files))
+	copy(result.Files, projectData.Files)
+
+	var candidates []int
+	for i, file := range result.Files {
+		if file.Content != "" {
+			candidates = append(candidates, i)
+		}
+		result.Files[i].Content = ""
+		result.Files[i].Diff = ""
+	}
+	// Highest priority first; within a priority, smaller files first so that a
+	// single large file does not crowd out many small ones
+	sort.SliceStable(candidates, func(a, b int) bool {
+		fileA, fileB := projectData.Files[candidates[a]], projectData.Files[candidates[b]]
+		priorityA, priorityB := filePriority(fileA.Path, rules), filePriority(fileB.Path, rules)
+		if priorityA != priorityB {
+			return priorityA > priorityB
+		}
+		return len(fileA.Content) < len(fileB.Content)
+	})
+
+	base, err := measure(result)
+	if err != nil {
+		return ProjectData{}, report, err
+	}
+	if base > maxTokens {
+		return ProjectData{}, report, fmt.Errorf("the project structure alone needs %d tokens, more than the budget of %d", base, maxTokens)
+	}
+	empty, err := measure(ProjectData{})
+	if err != nil {
+		return ProjectData{}, report, err
+	}
+	fileCost := func(file FileData) (int, error) {
+		tokens, err := measure(ProjectData{Files: []FileData{file}})
+		return tokens - empty, err
+	}
+
+	remaining := maxTokens - base
+	dropped := make(map[int]bool)
+	costs := make(map[int]int)
+	var kept []int
+	for _, i := range candidates {
+		file := projectData.Files[i]
+		cost, err := fileCost(file)
+		if err != nil {
+			return ProjectData{}, report, err
+		}
+		if cost <= remaining {
+			result.Files[i] = file
+			remaining -= cost
+			costs[i] = cost
+			kept = append(kept, i)
+			continue
+		}
+
+		if truncate && file.Encoding == "" {
+			truncated, ok, err := truncateToTokens(file, remaining, fileCost)
+			if err != nil {
+				return ProjectData{}, report, err
+			}
+			if ok {
+				cost, err = fileCost(truncated)
+				if err != nil {
+					return ProjectData{}, report, err
+				}
+				result.Files[i] = truncated
+				remaining -= cost
+				costs[i] = cost
+				kept = append(kept, i)
+				report.Truncated = append(report.Truncated, file.Path)
+				continue
+			}
+		}
+		dropped[i] = true
+		report.Dropped = append(report.Dropped, file.Path)
+	}
+
+	withoutDropped := func() ProjectData {
+		data := result
+		data.Files = nil
+		for i, file := range result.Files {
+			if !dropped[i] {
+				data.Files = append(data.Files, file)
+			}
+		}
+		return data
+	}
+
+	// The per-file estimates ignore how files share the tree, so confirm the
+	// real size and give up the files kept last until their costs cover the
+	// excess
+	for {
+		fitted := withoutDropped()
+		used, err := measure(fitted)
+		if err != nil {
+			return ProjectData{}, report, err
+		}
+		if used <= maxTokens || len(kept) == 0 {
+			report.UsedTokens = used
+			return fitted, report, nil
+		}
+		for excess := used - maxTokens; excess > 0 && len(kept) > 0; {
+			last := kept[len(kept)-1]
+			kept = kept[:len(kept)-1]
+			excess -= costs[last]
+			dropped[last] = true
+			report.Dropped = append(report.Dropped, result.Files[last].Path)
+			for j, path := range report.Truncated {
+				if path == result.Files[last].Path {
+					report.Truncated = append(report.Truncated[:j], report.Truncated[j+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// truncateToTokens keeps as many leading lines of file as fit in budget tokens.
+func truncateToTokens(file FileData, budget int, fileCost func(FileData) (int, error)) (FileData, bool, error) {
+	lines := strings.SplitAfter(file.Content, "\n")
+	withLines := func(n int) FileData {
+		truncated := file
+		truncated.Content = strings.Join(lines[:n], "") + fmt.Sprintf("\n[... truncated by onefile: %d of %d lines kept]\n", n, len(lines))
+		return truncated
+	}
+
+	low, high := 0, len(lines)
+	for low < high {
+		mid := (low + high + 1) / 2
+		cost, err := fileCost(withLines(mid))
+		if err != nil {
+			return FileData{}, false, err
+		}
+		if cost <= budget {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	if low == 0 {
+		return FileData{}, false, nil
+	}
+	return withLines(low), true, nil
+}
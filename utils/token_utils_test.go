@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFitToTokenBudget(t *testing.T) {
+	projectData := ProjectData{
+		Files: []FileData{
+			{Path: "README.md", Content: strings.Repeat("docs ", 200)},
+			{Path: "main.go", Content: strings.Repeat("code ", 200)},
+			{Path: "main_test.go", Content: strings.Repeat("test ", 200)},
+		},
+	}
+	tokenizer, err := GetTokenizer("chars")
+	if err != nil {
+		t.Fatalf("GetTokenizer failed: %v", err)
+	}
+	rules, err := ParsePriorityRules(DefaultPriorityRules)
+	if err != nil {
+		t.Fatalf("ParsePriorityRules failed: %v", err)
+	}
+	renders := 0
+	render := func(data ProjectData) (string, error) {
+		renders++
+		return GenerateMarkdown(data, false, false, false), nil
+	}
+
+	fitted, report, err := FitToTokenBudget(projectData, 700, tokenizer, rules, false, render)
+	if err != nil {
+		t.Fatalf("FitToTokenBudget failed: %v", err)
+	}
+	if report.UsedTokens > 700 {
+		t.Errorf("UsedTokens = %d; want at most 700", report.UsedTokens)
+	}
+	if paths := getFilePaths(fitted.Files); !reflect.DeepEqual(paths, []string{"README.md", "main.go"}) || fitted.Files[0].Content == "" || fitted.Files[1].Content == "" {
+		t.Errorf("Kept %v; want README.md and main.go with their contents", paths)
+	}
+	if !reflect.DeepEqual(report.Dropped, []string{"main_test.go"}) {
+		t.Errorf("Dropped = %v; want [main_test.go]", report.Dropped)
+	}
+
+	// Each file is rendered once on its own, not the project once per dropped file
+	var many ProjectData
+	for i := 0; i < 200; i++ {
+		many.Files = append(many.Files, FileData{Path: fmt.Sprintf("f%03d.go", i), Content: strings.Repeat("code ", 20)})
+	}
+	renders = 0
+	fitted, report, err = FitToTokenBudget(many, 2000, tokenizer, nil, false, render)
+	if err != nil {
+		t.Fatalf("FitToTokenBudget failed: %v", err)
+	}
+	if renders > len(many.Files)+4 {
+		t.Errorf("Rendered %d times for %d files", renders, len(many.Files))
+	}
+	if len(fitted.Files)+len(report.Dropped) != len(many.Files) || report.UsedTokens > 2000 {
+		t.Errorf("Kept %d and dropped %d of %d files in %d tokens", len(fitted.Files), len(report.Dropped), len(many.Files), report.UsedTokens)
+	}
+}
+
+func TestApproximateTokenCount(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"func main() {}", 4},
+		{"getLanguageFromExtension", 4},
+		{"I'll be there", 4},
+	}
+
+	for _, tc := range testCases {
+		if got := approximateTokenCount(tc.text); got != tc.expected {
+			t.Errorf("approximateTokenCount(%q) = %d; want %d", tc.text, got, tc.expected)
+		}
+	}
+}
@@ -1,11 +1,50 @@
 package utils
 
+import (
+	"os"
+	"time"
+)
+
 type FileData struct {
-	Path    string `json:"path"`
-	Content string `json:"content"`
+	Path          string      `json:"path"`
+	Content       string      `json:"content"`
+	Mode          os.FileMode `json:"mode,omitempty"`
+	ModTime       *time.Time  `json:"mod_time,omitempty"`
+	SymlinkTarget string      `json:"symlink_target,omitempty"`
+	Encoding      string      `json:"encoding,omitempty"`
+	Diff          string      `json:"diff,omitempty"`
+	// Segment marks a piece of a file that SplitJSON cut across parts
+	Segment *FileSegment `json:"segment,omitempty"`
+
+	// contentPending marks a structure entry whose content is streamed later
+	contentPending bool
+	// textChecked is set once the content was read and checked for text,
+	// nonText then marks a file found not to be text
+	textChecked bool
+	nonText     bool
+}
+
+// FileSegment numbers the pieces of a file split across the parts of a dump;
+// their contents joined in order are the whole file.
+type FileSegment struct {
+	Part  int `json:"part"`
+	Total int `json:"total"`
+}
+
+// ChunkInfo is the chunk index of one part of a project split by SplitJSON.
+type ChunkInfo struct {
+	Part  int      `json:"part"`
+	Total int      `json:"total"`
+	Files []string `json:"files"`
 }
 
 type ProjectData struct {
+	// Chunk is set on the parts of a split dump
+	Chunk *ChunkInfo `json:"chunk,omitempty"`
+	// Source, Ref and Commit record where a fetched project came from
+	Source      string     `json:"source,omitempty"`
+	Ref         string     `json:"ref,omitempty"`
+	Commit      string     `json:"commit,omitempty"`
 	Directories []string   `json:"directories"`
 	Files       []FileData `json:"files"`
 }
@@ -19,5 +58,18 @@ type GithubContent struct {
 }
 
 type GithubRepo struct {
+	Name     string   `json:"name"`
+	Fork     bool     `json:"fork"`
+	Archived bool     `json:"archived"`
+	Private  bool     `json:"private"`
+	Language string   `json:"language"`
+	Topics   []string `json:"topics"`
+}
+
+type GitlabTreeEntry struct {
+	ID   string `json:"id"`
 	Name string `json:"name"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Mode string `json:"mode"`
 }
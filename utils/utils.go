@@ -30,14 +30,93 @@ func CreateGitIgnoreMatcher(patterns []string) *ignore.GitIgnore {
 	return ignore.CompileIgnoreLines(patterns...)
 }
 
-func MatchesPatterns(path string, gitIgnore *ignore.GitIgnore, includeGit, includeNonText bool) bool {
+// PathMatcher combines exclude patterns with an allowlist of include patterns.
+// A path is ignored if it matches an exclude pattern, or if include patterns
+// are given and it matches none of them; excludes always win over includes.
+// Include patterns only apply to files, so directories (paths ending in a
+// slash) are only checked against the excludes.
+type PathMatcher struct {
+	exclude ignore.IgnoreParser
+	include *ignore.GitIgnore
+}
+
+// CreatePathMatcher adds includePatterns to exclude. Without include patterns
+// exclude is returned unchanged.
+func CreatePathMatcher(exclude ignore.IgnoreParser, includePatterns []string) ignore.IgnoreParser {
+	if len(includePatterns) == 0 {
+		return exclude
+	}
+	return &PathMatcher{exclude: exclude, include: ignore.CompileIgnoreLines(includePatterns...)}
+}
+
+func (m *PathMatcher) MatchesPath(path string) bool {
+	matched, _ := m.MatchesPathHow(path)
+	return matched
+}
+
+// MatchesPathHow is MatchesPath that also returns the exclude pattern that
+// matched; paths left out by the include patterns have no pattern.
+func (m *PathMatcher) MatchesPathHow(path string) (bool, *ignore.IgnorePattern) {
+	if matched, pattern := m.exclude.MatchesPathHow(path); matched {
+		return true, pattern
+	}
+	isDir := strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(os.PathSeparator))
+	return !isDir && !m.include.MatchesPath(path), nil
+}
+
+// MatchesPatterns reports whether path passes the patterns and, unless
+// includeNonText is set, is a text file type known from its name. Files of
+// other types can only be told apart once read, see setFileContent.
+func MatchesPatterns(path string, gitIgnore ignore.IgnoreParser, includeGit, includeNonText bool) bool {
+	if !matchesPathPatterns(path, gitIgnore, includeGit) {
+		return false
+	}
+	return includeNonText || isTextName(path)
+}
+
+// matchesPathPatterns is MatchesPatterns without the text check, for entries
+// that are filtered before their content has been read.
+func matchesPathPatterns(path string, gitIgnore ignore.IgnoreParser, includeGit bool) bool {
 	if !includeGit && (strings.HasPrefix(path, ".git"+string(os.PathSeparator)) || path == ".git") {
 		return false
 	}
-	if gitIgnore.MatchesPath(path) {
+	return !gitIgnore.MatchesPath(path)
+}
+
+// isOutputFile reports whether file belongs in the generated JSON or Markdown
+// output, going by the text check made when its content was read.
+func isOutputFile(file FileData, includeGit, includeNonText bool) bool {
+	if !includeGit && strings.HasPrefix(file.Path, ".git/") {
+		return false
+	}
+	return includeNonText || !file.isNonText()
+}
+
+// isStructureFile reports whether file is listed in the project structure of
+// the Markdown output. Non-text files that were read are listed like pending
+// ones, since a streamed dump writes the structure before any file is read.
+func isStructureFile(file FileData, includeGit, includeNonText, showExcluded bool) bool {
+	if !includeGit && strings.HasPrefix(file.Path, ".git/") {
 		return false
 	}
-	return includeNonText || isTextFile(path)
+	if showExcluded || file.contentPending || file.SymlinkTarget != "" || (file.textChecked && file.nonText) {
+		return true
+	}
+	return file.Content != "" && isOutputFile(file, includeGit, includeNonText)
+}
+
+// FilterProject clears the contents of the files in projectData that gitIgnore
+// ignores, so that they are treated like files excluded while dumping.
+func FilterProject(projectData ProjectData, gitIgnore ignore.IgnoreParser) ProjectData {
+	filtered := projectData
+	filtered.Files = make([]FileData, len(projectData.Files))
+	for i, file := range projectData.Files {
+		if gitIgnore.MatchesPath(file.Path) {
+			file = FileData{Path: file.Path, Mode: file.Mode, ModTime: file.ModTime}
+		}
+		filtered.Files[i] = file
+	}
+	return filtered
 }
 
 func ParsePatterns(patterns []string) ([]string, error) {
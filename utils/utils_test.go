@@ -32,3 +32,38 @@ func TestMatchesPatterns(t *testing.T) {
 		}
 	}
 }
+
+func TestPathMatcherIncludes(t *testing.T) {
+	exclude := CreateGitIgnoreMatcher([]string{"*_test.go"})
+	gitIgnore := CreatePathMatcher(exclude, []string{"cmd/**/*.go", "utils/**/*.go", "/go.mod"})
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"cmd/dump.go", true},
+		{"utils/json/json_utils.go", true},
+		{"utils/utils_test.go", false},
+		{"go.mod", true},
+		{"vendor/go.mod", false},
+		{"main.go", false},
+		{"README.md", false},
+	}
+
+	for _, tc := range testCases {
+		if result := MatchesPatterns(tc.path, gitIgnore, false, true); result != tc.expected {
+			t.Errorf("MatchesPatterns(%q) = %v; want %v", tc.path, result, tc.expected)
+		}
+	}
+	if gitIgnore.MatchesPath("docs/") {
+		t.Errorf("Include patterns should not exclude directories")
+	}
+
+	projectData := FilterProject(ProjectData{Files: []FileData{
+		{Path: "cmd/dump.go", Content: "package cmd\n"},
+		{Path: "README.md", Content: "# OneFile\n"},
+	}}, gitIgnore)
+	if projectData.Files[0].Content == "" || projectData.Files[1].Content != "" {
+		t.Errorf("FilterProject kept the wrong contents: %+v", projectData.Files)
+	}
+}